@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	gitformation "github.com/jeremyhahn/gitformation/internal/git"
+	"github.com/jeremyhahn/gitformation/internal/plan"
+	"github.com/jeremyhahn/gitformation/internal/service/cloudformation"
+	"github.com/spf13/cobra"
+)
+
+var PlanFile string
+
+func init() {
+
+	applyCmd.PersistentFlags().StringVar(&PlanFile, "plan", "", "Path to a plan file created by the plan command")
+	addExecutionFlags(applyCmd)
+	addRepoPathFlag(applyCmd)
+	addGuardFlags(applyCmd)
+
+	rootCmd.AddCommand(applyCmd)
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Executes a plan file created by the plan command",
+	Long: `Executes exactly the operations described in a plan file. The plan is
+	rejected if its checksum does not match its contents, or if the revision it
+	was created for (HEAD by default) has moved since the plan was created.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if PlanFile == "" {
+			return argRequiredError("--plan")
+		}
+
+		p, err := plan.Load(PlanFile)
+		if err != nil {
+			return fmt.Errorf("unable to load plan %s: %w", PlanFile, err)
+		}
+
+		if p.Uncommitted {
+			return fmt.Errorf("plan %s was created from uncommitted changes and cannot be applied", PlanFile)
+		}
+
+		// Planned templates may be nested in submodules
+		gitParser, err := gitformation.NewLocalRepoParser(App.Logger, RepoPath,
+			&gitformation.ParserOptions{RecurseSubmodules: true})
+		if err != nil {
+			return err
+		}
+		ref := p.Ref
+		if ref == "" {
+			ref = "HEAD"
+		}
+		commit, err := gitParser.ResolveCommit(ref)
+		if err != nil {
+			return err
+		}
+		if commit != p.Commit {
+			return fmt.Errorf("plan was created for %s at commit %s, but %s is now %s", ref, p.Commit, ref, commit)
+		}
+		if err := checkGuardRules(gitParser, p.Environment, "", p.Commit); err != nil {
+			return err
+		}
+
+		var deploymentBucket *cloudformation.DeploymentBucket
+		if p.TemplateBucket != "" {
+			deploymentBucket = &cloudformation.DeploymentBucket{
+				BucketName: p.TemplateBucket,
+				KeyPrefix:  p.TemplateBucketKeyPrefix,
+				KMSKeyId:   p.TemplateBucketKMSKeyId,
+				Endpoint:   S3Endpoint}
+		}
+
+		options := &cloudformation.ServiceOptions{
+			Region:             p.Region,
+			Profile:            p.Profile,
+			ProfilePrefix:      p.ProfilePrefix,
+			Environment:        p.Environment,
+			Bucket:             deploymentBucket,
+			ExitOnError:        ExitOnError,
+			WaitForStackResult: WaitForStackResult,
+			DryRun:             DryRun,
+			UseChangeSets:      UseChangeSets || ChangeSetCreates,
+			ChangeSetCreates:   ChangeSetCreates,
+			ReviewChangeSet:    reviewChangeSet,
+			TemplateReader: func(filePath string) ([]byte, error) {
+				return gitParser.ReadFile(p.Commit, filePath)
+			},
+			StackTimeout: StackTimeout,
+			StreamEvents: StreamEvents}
+
+		cloudformationService, err := cloudformation.NewCloudFormationService(App.Logger, options)
+		if err != nil {
+			return err
+		}
+		if p.Service != cloudformationService.Name() {
+			return fmt.Errorf("unsupported plan service: %s", p.Service)
+		}
+
+		executor := executor.NewExecutor(
+			App.Logger,
+			&executor.ExecutorOptions{
+				Parallel:    Parallel,
+				ExitOnError: ExitOnError},
+			nil,
+			cloudformationService)
+
+		result, err := executor.Apply(p)
+		if err != nil {
+			return err
+		}
+
+		if err := outputResult(OutputFormat, result); err != nil {
+			return err
+		}
+
+		return outcomeError(result)
+	},
+}
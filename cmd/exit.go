@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jeremyhahn/gitformation/internal/executor"
+)
+
+// Process exit codes, so CI pipelines can branch on the outcome of a run
+const (
+	ExitSuccess        = 0 // Every operation succeeded or was unchanged
+	ExitFailure        = 1 // Every operation failed, or the run could not start
+	ExitPartialFailure = 2 // Some operations failed while others succeeded
+	ExitNothingToDo    = 3 // The commit did not change any stacks
+)
+
+// Returned by a command to exit with a specific exit code. The error
+// is printed before exiting, unless it is nil.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
+// Returns the error that exits with the code for the outcome of an
+// execution, or nil if every operation succeeded.
+func outcomeError(result *executor.ExecutionResult) error {
+	switch result.Summary.Outcome {
+	case executor.OutcomeNothingToDo:
+		return &exitCodeError{code: ExitNothingToDo}
+	case executor.OutcomePartialFailure:
+		return &exitCodeError{code: ExitPartialFailure}
+	case executor.OutcomeFailure:
+		return &exitCodeError{code: ExitFailure}
+	}
+	return nil
+}
@@ -1,13 +1,15 @@
 package cmd
 
 import (
-	gitformation "github.com/jeremyhahn/gitformation/internal/git"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 
-	filterCmd.PersistentFlags().StringVarP(&Filter, "filter", "f", "[a-zA-Z0-9./]+", "Regular expressin to filter files from the repository. Default is process all files. (ex: --filter=templates/*)")
+	filterCmd.PersistentFlags().StringVarP(&Filter, "filter", "f", "[a-zA-Z0-9./]+", "Regular expression to filter files from the repository, matching anywhere in the path. Prefer --include and --exclude for anchored globs. Default is process all files.")
+	addOutputFlags(filterCmd)
+	addGitFlags(filterCmd)
+	addRemoteFlags(filterCmd)
 	filterCmd.PersistentFlags().BoolVar(&DryRun, "dry-run", false, "Regular expressin used to filter processed files in the repository")
 
 	rootCmd.AddCommand(filterCmd)
@@ -19,11 +21,19 @@ var filterCmd = &cobra.Command{
 	Long: `Parses the git log using the --filter option and returns
 		   all of the matching files that will be processed when run
 		   using live services.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 
-		gitParser := gitformation.NewLocalRepoParser(App.Logger, CommitHash)
-		changeSet := gitParser.Diff(Filter)
+		gitParser, err := newGitParser()
+		if err != nil {
+			return err
+		}
+		defer gitParser.Close()
 
-		outputChangeSet(OutputFormat, changeSet)
+		changeSet, _, err := diffRevisions(gitParser)
+		if err != nil {
+			return err
+		}
+
+		return outputChangeSet(OutputFormat, changeSet)
 	},
 }
@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	gitformation "github.com/jeremyhahn/gitformation/internal/git"
+	"github.com/jeremyhahn/gitformation/internal/service/cloudformation"
+	"github.com/spf13/cobra"
+)
+
+var RenameThreshold int
+var FromRevision string
+var ToRevision string
+var SinceLastDeploy bool
+var MarkerRemote string
+var MergeStrategy string
+var Worktree bool
+var Include []string
+var RepoPath string
+var RepoURL string
+var RepoRef string
+var CloneDepth int
+var CloneInMemory bool
+var SSHKeyFile string
+var SSHAgent bool
+var GitUsername string
+var GitToken string
+
+// Environment variables for secrets, so they are not passed on the command line
+const (
+	GitTokenEnv         = "GITFORMATION_GIT_TOKEN"
+	SSHKeyPassphraseEnv = "GITFORMATION_SSH_KEY_PASSPHRASE"
+)
+
+var Exclude []string
+var Staged bool
+var RecurseSubmodules bool
+var RequireSigned bool
+var SigningKeyring string
+var AllowedSigners string
+var SigningKeysRef string
+var GuardRulesFile string
+
+// Registers the flag for the path of the local repository.
+// Shared by every command that opens the repository.
+func addRepoPathFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&RepoPath, "repo-path", ".", "Path to the local repository, or any directory inside it. File paths are relative to the repository root.")
+}
+
+// Registers the flags that control how changes are detected
+// in the repository. Shared by every command that diffs commits.
+func addGitFlags(cmd *cobra.Command) {
+	addRepoPathFlag(cmd)
+	cmd.PersistentFlags().StringVar(&FromRevision, "from", "", "The revision to diff from, such as a commit hash, branch, tag or HEAD~3 (default: the parent of --to)")
+	cmd.PersistentFlags().StringVar(&ToRevision, "to", "HEAD", "The revision to deploy, such as a commit hash, branch, tag or HEAD~3")
+	cmd.PersistentFlags().IntVar(&RenameThreshold, "rename-threshold", gitformation.DefaultRenameThreshold, "Minimum similarity percentage for a deleted and created file to be treated as a rename, or 0 to disable rename detection")
+	cmd.PersistentFlags().StringArrayVar(&Include, "include", []string{}, "Only process files matching this glob, relative to the repository root. May be repeated. (ex: --include 'templates/**/*.yaml')")
+	cmd.PersistentFlags().StringArrayVar(&Exclude, "exclude", []string{}, "Never process files matching this glob, relative to the repository root. May be repeated. (ex: --exclude '**/*.md')")
+	cmd.PersistentFlags().BoolVar(&Worktree, "worktree", false, "Diff the uncommitted changes in the working tree, including staged and untracked files, against HEAD")
+	cmd.PersistentFlags().BoolVar(&Staged, "staged", false, "Diff only the changes staged in the index against HEAD")
+	cmd.PersistentFlags().BoolVar(&RecurseSubmodules, "recurse-submodules", false, "Diff the old and new commits of changed submodules, processing the nested files as paths inside the submodule (ex: vendor/shared/templates/vpc.template)")
+	cmd.PersistentFlags().StringVar(&MergeStrategy, "merge-strategy", string(gitformation.MergeStrategyFirstParent), "How changes in a merge commit are detected when --from is not set (first-parent: diff against the mainline parent | union: combine the changes against every parent | merge-base: diff against the common ancestor of all parents)")
+}
+
+// Diffs the --from and --to revisions, returning the changes and the
+// hash of the commit being deployed. --commit is accepted as --from.
+// With --worktree or --staged, the uncommitted changes are diffed
+// against HEAD instead.
+func diffRevisions(gitParser *gitformation.GitParser) (*gitformation.ChangeSet, string, error) {
+	if uncommitted() {
+		if FromRevision != "" || CommitHash != "" || ToRevision != "HEAD" {
+			return nil, "", errors.New("--worktree and --staged cannot be used with --from, --to or --commit")
+		}
+		head, err := gitParser.Head()
+		if err != nil {
+			return nil, "", err
+		}
+		changeSet, err := gitParser.DiffWorktree(Staged)
+		if err != nil {
+			return nil, "", err
+		}
+		return changeSet, head, nil
+	}
+	to, err := gitParser.ResolveCommit(ToRevision)
+	if err != nil {
+		return nil, "", err
+	}
+	changeSet, err := gitParser.Diff(fromRevision(), to)
+	if err != nil {
+		return nil, "", err
+	}
+	return changeSet, to, nil
+}
+
+// Returns the --from revision, accepting --commit as --from
+func fromRevision() string {
+	if FromRevision != "" {
+		return FromRevision
+	}
+	return CommitHash
+}
+
+// Returns true if uncommitted changes are being diffed
+func uncommitted() bool {
+	return Worktree || Staged
+}
+
+// Returns a template reader for the commit being deployed, or for
+// the working tree or index with --worktree or --staged.
+func templateReader(gitParser *gitformation.GitParser, commit string) cloudformation.TemplateReader {
+	if uncommitted() {
+		return func(filePath string) ([]byte, error) {
+			return gitParser.ReadWorktreeFile(filePath, Staged)
+		}
+	}
+	return func(filePath string) ([]byte, error) {
+		return gitParser.ReadFile(commit, filePath)
+	}
+}
+
+// Returns a template lister for the commit being deployed, or for
+// the working tree or index with --worktree or --staged.
+func templateLister(gitParser *gitformation.GitParser, commit string) cloudformation.TemplateLister {
+	if uncommitted() {
+		return func() ([]string, error) {
+			return gitParser.ListWorktreeFiles(Staged)
+		}
+	}
+	return func() ([]string, error) {
+		return gitParser.ListFiles(commit)
+	}
+}
+
+// Registers the flags for cloning a remote repository, so deployments
+// do not need a local checkout. Shared by manage-stacks and filter.
+func addRemoteFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&RepoURL, "repo", "", "URL of a remote repository to clone and deploy instead of the local repository (ex: git@github.com:org/infra.git)")
+	cmd.PersistentFlags().StringVar(&RepoRef, "ref", "", "Branch or tag of the --repo to clone (default: the remote's default branch)")
+	cmd.PersistentFlags().IntVar(&CloneDepth, "depth", 0, "Number of commits to fetch from the --repo, or 0 for the full history. Use at least 2 to diff the last commit.")
+	cmd.PersistentFlags().BoolVar(&CloneInMemory, "in-memory", false, "Clone the --repo into memory instead of a temporary directory")
+	cmd.PersistentFlags().StringVar(&SSHKeyFile, "ssh-key", "", "Private key file for SSH authentication to the --repo. The passphrase is read from "+SSHKeyPassphraseEnv)
+	cmd.PersistentFlags().BoolVar(&SSHAgent, "ssh-agent", false, "Authenticate to the --repo using the SSH agent")
+	cmd.PersistentFlags().StringVar(&GitUsername, "git-username", "", "Username for HTTPS token authentication to the --repo (default: git)")
+	cmd.PersistentFlags().StringVar(&GitToken, "git-token", "", "Token for HTTPS authentication to the --repo (default: $"+GitTokenEnv+")")
+}
+
+// Opens the local repository, or clones the --repo, using the git flags.
+// The parser must be closed to remove a temporary clone.
+func newGitParser() (*gitformation.GitParser, error) {
+	if RepoURL != "" {
+		return newRemoteGitParser()
+	}
+	if RepoRef != "" {
+		return nil, errors.New("--ref requires --repo")
+	}
+	return gitformation.NewLocalRepoParser(App.Logger, RepoPath, parserOptions())
+}
+
+// Clones the --repo using the remote flags
+func newRemoteGitParser() (*gitformation.GitParser, error) {
+	if uncommitted() {
+		return nil, errors.New("--worktree and --staged cannot be used with --repo")
+	}
+	if RepoPath != "." {
+		return nil, errors.New("--repo-path cannot be used with --repo")
+	}
+	// The clone is removed when the run ends, so the deployment marker
+	// must be pushed to a remote to be found by the next run
+	if SinceLastDeploy && MarkerRemote == "" {
+		return nil, errors.New("--since-last-deploy with --repo requires --marker-remote, the deployment marker would be lost with the clone")
+	}
+	token := GitToken
+	if token == "" {
+		token = os.Getenv(GitTokenEnv)
+	}
+	return gitformation.NewRemoteRepoParser(App.Logger, &gitformation.RemoteOptions{
+		URL:              RepoURL,
+		Ref:              RepoRef,
+		Depth:            CloneDepth,
+		InMemory:         CloneInMemory,
+		SSHKeyFile:       SSHKeyFile,
+		SSHKeyPassphrase: os.Getenv(SSHKeyPassphraseEnv),
+		SSHAgent:         SSHAgent,
+		Username:         GitUsername,
+		Token:            token}, parserOptions())
+}
+
+// Returns the parser options for the git flags
+func parserOptions() *gitformation.ParserOptions {
+	return &gitformation.ParserOptions{
+		Filter:            Filter,
+		Include:           Include,
+		Exclude:           Exclude,
+		RenameThreshold:   RenameThreshold,
+		MergeStrategy:     gitformation.MergeStrategy(MergeStrategy),
+		RecurseSubmodules: RecurseSubmodules}
+}
+
+// Registers the flags for deploying everything changed
+// since the last successful deployment to an environment
+func addDeployMarkerFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&SinceLastDeploy, "since-last-deploy", false, "Diff from the last commit successfully deployed to --env, and record --to as deployed when the run fully succeeds")
+	cmd.PersistentFlags().StringVar(&MarkerRemote, "marker-remote", "", "Git remote to fetch and push the deployment marker tag from (ex: origin)")
+}
+
+// Sets --from to the commit last successfully deployed to the --env.
+// If the environment has no deployment marker yet, the default --from
+// revision is used.
+func fromLastDeploy(gitParser *gitformation.GitParser) error {
+	if FromRevision != "" || CommitHash != "" {
+		return errors.New("--since-last-deploy cannot be used with --from or --commit")
+	}
+	if uncommitted() {
+		return errors.New("--since-last-deploy cannot be used with --worktree or --staged")
+	}
+	if MarkerRemote != "" {
+		if err := gitParser.FetchDeployMarker(MarkerRemote, DeploymentEnv); err != nil {
+			return err
+		}
+	}
+	commit, err := gitParser.LastDeploy(DeploymentEnv)
+	if err != nil {
+		return err
+	}
+	if commit == "" {
+		App.Logger.Warningf("no deployment marker %s found, diffing from the parent of %s",
+			gitformation.DeployMarker(DeploymentEnv), ToRevision)
+		return nil
+	}
+	App.Logger.Infof("Deploying changes since the last deployment to %s (%s)", DeploymentEnv, commit)
+	FromRevision = commit
+	return nil
+}
+
+// Registers the flags for verifying that deployed commits are signed
+func addSignatureFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&RequireSigned, "require-signed", false, "Refuse to deploy unless the --to commit, or every commit since --from, has a valid GPG or SSH signature from a trusted key")
+	cmd.PersistentFlags().StringVar(&SigningKeyring, "signing-keyring", gitformation.DefaultKeyringFile, "Path of the armored GPG keyring of trusted signers in the repository")
+	cmd.PersistentFlags().StringVar(&AllowedSigners, "allowed-signers", gitformation.DefaultAllowedSignersFile, "Path of the SSH allowed signers file of trusted signers in the repository, in the format of git's gpg.ssh.allowedSignersFile")
+	cmd.PersistentFlags().StringVar(&SigningKeysRef, "signing-keys-ref", "", "The revision the trusted keys are read from, such as a protected tag or branch. Keys are never read from the commits being verified. (default: --from, or the last deployment with --since-last-deploy)")
+}
+
+// Verifies the signatures of the commits being deployed when
+// --require-signed is set, before any changes are detected
+func verifySignatures(gitParser *gitformation.GitParser) error {
+	if !RequireSigned {
+		return nil
+	}
+	if uncommitted() {
+		return errors.New("--require-signed cannot be used with --worktree or --staged")
+	}
+	if SigningKeysRef == "" && fromRevision() == "" {
+		return errors.New("--require-signed needs --from, --since-last-deploy or --signing-keys-ref to read the trusted keys from a revision that is not being deployed")
+	}
+	return gitParser.VerifyCommits(fromRevision(), ToRevision, &gitformation.SignatureOptions{
+		Keyring:        SigningKeyring,
+		AllowedSigners: AllowedSigners,
+		Revision:       SigningKeysRef})
+}
+
+// Registers the flag for the per-environment guard rules.
+// Shared by the manage-stacks and apply commands.
+func addGuardFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&GuardRulesFile, "guard-rules", "", "Path to a file of per-environment rules for the branches, tags, authors and committers allowed to deploy")
+}
+
+// Aborts the deployment if the commits being deployed to the environment
+// violate its --guard-rules. Checked before any changes are detected.
+func checkGuardRules(gitParser *gitformation.GitParser, env, from, to string) error {
+	if GuardRulesFile == "" {
+		return nil
+	}
+	rules, err := gitformation.LoadGuardRules(GuardRulesFile)
+	if err != nil {
+		return err
+	}
+	if rule := rules[env]; rule != nil && uncommitted() {
+		return fmt.Errorf("%w: uncommitted changes cannot be deployed to %s", gitformation.ErrGuardViolation, env)
+	}
+	return gitParser.CheckGuardRules(env, from, to, rules)
+}
+
+// Applies the commit message directives that decide whether the --env is
+// deployed at all. If the commit skips the deployment, the changes are
+// cleared so the run has nothing to do.
+func applyDirectives(changeSet *gitformation.ChangeSet) *gitformation.ChangeSet {
+	directives := changeSet.Directives
+	if directives.DeploysTo(DeploymentEnv) {
+		return changeSet
+	}
+	if directives.Skip {
+		App.Logger.Infof("Skipping deployment, the commit message contains %s", gitformation.SkipDeployDirective)
+	} else {
+		App.Logger.Infof("Skipping deployment, %s is not listed in %s: %s",
+			DeploymentEnv, gitformation.DeployEnvTrailer, strings.Join(directives.DeployEnv, ","))
+	}
+	skipped := gitformation.NewEmptyChangeSet()
+	skipped.Directives = directives
+	return skipped
+}
+
+// Records the deployed commit as the last successful deployment to the
+// --env, only if every operation succeeded. Dry runs, and deployments
+// skipped or scoped by commit message directives, are not recorded.
+func markDeployed(
+	gitParser *gitformation.GitParser,
+	commit string,
+	directives *gitformation.Directives,
+	result *executor.ExecutionResult) error {
+
+	if DryRun {
+		return nil
+	}
+	if !directives.DeploysTo(DeploymentEnv) || directives.IsScoped() {
+		App.Logger.Warningf("the deployment was skipped or scoped by commit message directives, the deployment marker for %s was not moved", DeploymentEnv)
+		return nil
+	}
+	switch result.Summary.Outcome {
+	case executor.OutcomeSuccess, executor.OutcomeNothingToDo:
+	default:
+		App.Logger.Warningf("not all operations succeeded, the deployment marker for %s was not moved", DeploymentEnv)
+		return nil
+	}
+	if result.Summary.InProgress() {
+		App.Logger.Warningf("not all stacks reached a terminal status, the deployment marker for %s was not moved", DeploymentEnv)
+		return nil
+	}
+	if err := gitParser.MarkDeployed(DeploymentEnv, commit); err != nil {
+		return err
+	}
+	if MarkerRemote != "" {
+		return gitParser.PushDeployMarker(MarkerRemote, DeploymentEnv)
+	}
+	return nil
+}
@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/jeremyhahn/gitformation/internal/executor"
-	gitformation "github.com/jeremyhahn/gitformation/internal/git"
 	"github.com/jeremyhahn/gitformation/internal/service/cloudformation"
 	"github.com/spf13/cobra"
 )
@@ -10,6 +16,8 @@ import (
 var Region string
 var DeploymentBucketName string
 var DeploymentBucketKeyPrefix string
+var DeploymentBucketKMSKeyId string
+var S3Endpoint string
 var DeploymentParameters map[string]string
 var Capabilities []string
 var DisableRollback bool
@@ -26,32 +34,66 @@ var Profile string
 var CommitHash string
 var ParameterFileMappings string
 var DependencyGraph string
+var StackNameMappings string
+var RenamePolicy string
+var UseChangeSets bool
+var ChangeSetCreates bool
+var AutoApprove bool
+var StackTimeout time.Duration
+var StreamEvents bool
 
 func init() {
 
-	manageStacksCmd.PersistentFlags().StringVarP(&Region, "region", "r", "us-east-1", "Target AWS region (ex: us-east-1)")
-	manageStacksCmd.PersistentFlags().StringVarP(&DeploymentBucketName, "template-bucket", "b", "", "S3 bucket name to deploy stacks from using --template-url (ex: my-bucket-name)")
-	manageStacksCmd.PersistentFlags().StringVarP(&DeploymentBucketKeyPrefix, "template-bucket-key", "k", "", "S3 bucket key prefix where templates are stored (ex: /my/sub/folder)")
-	manageStacksCmd.PersistentFlags().StringToStringVarP(&DeploymentParameters, "parameters", "p", nil, "Map of parameters to include with each cloudformation stack operation (ex: Environment=nonprod Foo=bar)")
-	manageStacksCmd.PersistentFlags().StringArrayVar(&Capabilities, "capabilities", []string{}, "List of cloudformation capabilities to use for the deployment (ex: CAPABILITY_NAMED_IAM)")
-	manageStacksCmd.PersistentFlags().BoolVar(&DisableRollback, "disable-rollback", false, "Disable cloudformation rollbacks on failure")
-	manageStacksCmd.PersistentFlags().BoolVarP(&ExitOnError, "exit-on-error", "e", true, "Stop processing and exit with a failure message if an error is encountered during a clodformation operation")
-	manageStacksCmd.PersistentFlags().BoolVarP(&Parallel, "parallel", "a", true, "Process each file in a parallel goroutine (async)")
-	manageStacksCmd.PersistentFlags().StringVarP(&Filter, "filter", "f", "[a-zA-Z0-9./]+", "Regular expressin to filter files from the repository. Default is process all files. (ex: --filter=templates/*)")
-	manageStacksCmd.PersistentFlags().BoolVar(&DryRun, "dry-run", false, "Regular expressin used to filter processed files in the repository")
-	manageStacksCmd.PersistentFlags().StringVar(&OutputFormat, "format", "human", "The output format to use (human | json | yaml)")
-	manageStacksCmd.PersistentFlags().BoolVarP(&WaitForStackResult, "wait", "w", false, "Wait for results from cloudformation stack operations")
-	manageStacksCmd.PersistentFlags().StringVar(&ParameterFiles, "parameter-files", "./cloudformation/parameters", "Path to directory with cloudformation parameter files")
-	manageStacksCmd.PersistentFlags().StringVar(&DeploymentEnv, "env", "nonprod", "Target deployment environment")
-	manageStacksCmd.PersistentFlags().StringVar(&ProfilePrefix, "profile-prefix", "jeremyhahn", "Profile prefix to append the environment name to (ex: myco results in profile: myco-nonprod)")
-	manageStacksCmd.PersistentFlags().StringVar(&Profile, "profile", "nonprod", "Target deployment account")
-	manageStacksCmd.PersistentFlags().StringVar(&CommitHash, "commit", "", "The commit hash to process")
-	manageStacksCmd.PersistentFlags().StringVar(&ParameterFileMappings, "parameter-mappings", "./examples/cloudformation/mappings/nonprod/mappings.yaml", "Path to template parameter file mappings")
-	manageStacksCmd.PersistentFlags().StringVar(&DependencyGraph, "dependency-graph", "./examples/cloudformation/dependencies/nonprod/graph.yaml", "Path to template dependency graph")
+	addStackFlags(manageStacksCmd)
+	addExecutionFlags(manageStacksCmd)
+	addDeployMarkerFlags(manageStacksCmd)
+	addRemoteFlags(manageStacksCmd)
+	addSignatureFlags(manageStacksCmd)
+	addGuardFlags(manageStacksCmd)
 
 	rootCmd.AddCommand(manageStacksCmd)
 }
 
+// Registers the flags that control how stack operations are
+// executed. Shared by the manage-stacks and apply commands.
+func addExecutionFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVarP(&ExitOnError, "exit-on-error", "e", true, "Stop processing and exit with a failure message if an error is encountered during a clodformation operation")
+	cmd.PersistentFlags().BoolVarP(&Parallel, "parallel", "a", true, "Process each file in a parallel goroutine (async)")
+	cmd.PersistentFlags().BoolVar(&DryRun, "dry-run", false, "Print the stack operation parameters without executing them")
+	addOutputFlags(cmd)
+	cmd.PersistentFlags().BoolVarP(&WaitForStackResult, "wait", "w", false, "Wait for results from cloudformation stack operations")
+	cmd.PersistentFlags().BoolVar(&StreamEvents, "events", true, "Stream stack events to the console while waiting for stack operations")
+	cmd.PersistentFlags().DurationVar(&StackTimeout, "stack-timeout", 60*time.Minute, "Maximum time to wait for each stack operation to reach a terminal state")
+	cmd.PersistentFlags().BoolVar(&UseChangeSets, "change-sets", false, "Update stacks using change sets and show the resource level changes before executing them")
+	cmd.PersistentFlags().BoolVar(&ChangeSetCreates, "change-set-creates", false, "Create new stacks using change sets (implies --change-sets)")
+	cmd.PersistentFlags().BoolVar(&AutoApprove, "auto-approve", false, "Execute change sets without prompting for confirmation")
+	cmd.PersistentFlags().StringVar(&S3Endpoint, "s3-endpoint", "", "Custom S3 endpoint used to upload templates, such as a local S3-compatible server (ex: http://localhost:9000)")
+}
+
+// Registers the flags used to resolve stack operations from a git
+// commit. Shared by the manage-stacks and plan commands.
+func addStackFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVarP(&Region, "region", "r", "us-east-1", "Target AWS region (ex: us-east-1)")
+	cmd.PersistentFlags().StringVarP(&DeploymentBucketName, "template-bucket", "b", "", "S3 bucket name to deploy stacks from using --template-url (ex: my-bucket-name)")
+	cmd.PersistentFlags().StringVarP(&DeploymentBucketKeyPrefix, "template-bucket-key", "k", "", "S3 bucket key prefix where templates are stored (ex: /my/sub/folder)")
+	cmd.PersistentFlags().StringVar(&DeploymentBucketKMSKeyId, "template-bucket-kms-key", "", "KMS key id or alias used to encrypt uploaded templates with SSE-KMS (ex: alias/deployments)")
+	cmd.PersistentFlags().StringToStringVarP(&DeploymentParameters, "parameters", "p", nil, "Map of parameters to include with each cloudformation stack operation (ex: Environment=nonprod Foo=bar)")
+	cmd.PersistentFlags().StringArrayVar(&Capabilities, "capabilities", []string{}, "List of cloudformation capabilities to use for the deployment (ex: CAPABILITY_NAMED_IAM)")
+	cmd.PersistentFlags().BoolVar(&DisableRollback, "disable-rollback", false, "Disable cloudformation rollbacks on failure")
+	cmd.PersistentFlags().StringVarP(&Filter, "filter", "f", "[a-zA-Z0-9./]+", "Regular expression to filter files from the repository, matching anywhere in the path. Prefer --include and --exclude for anchored globs. Default is process all files.")
+	cmd.PersistentFlags().StringVar(&ParameterFiles, "parameter-files", "./cloudformation/parameters", "Path to directory with cloudformation parameter files, relative to the repository root")
+	cmd.PersistentFlags().StringVar(&DeploymentEnv, "env", "nonprod", "Target deployment environment")
+	cmd.PersistentFlags().StringVar(&ProfilePrefix, "profile-prefix", "jeremyhahn", "Profile prefix to append the environment name to (ex: myco results in profile: myco-nonprod)")
+	cmd.PersistentFlags().StringVar(&Profile, "profile", "nonprod", "Target deployment account")
+	cmd.PersistentFlags().StringVar(&CommitHash, "commit", "", "The commit hash to diff from")
+	cmd.PersistentFlags().MarkDeprecated("commit", "use --from instead")
+	cmd.PersistentFlags().StringVar(&ParameterFileMappings, "parameter-mappings", "./examples/cloudformation/mappings/nonprod/mappings.yaml", "Path to template parameter file mappings, relative to the repository root")
+	cmd.PersistentFlags().StringVar(&DependencyGraph, "dependency-graph", "./examples/cloudformation/dependencies/nonprod/graph.yaml", "Path to template dependency graph, relative to the repository root")
+	cmd.PersistentFlags().StringVar(&StackNameMappings, "stack-names", "", "Path to a file mapping template files to stack names, relative to the repository root")
+	cmd.PersistentFlags().StringVar(&RenamePolicy, "rename-policy", string(executor.RenamePolicyReplace), "How renamed templates are deployed (replace: delete the old stack and create a new one | keep: update the old stack)")
+	addGitFlags(cmd)
+}
+
 var manageStacksCmd = &cobra.Command{
 	Use:   "manage-stacks",
 	Short: "Binds git commit changes with AWS CloudFormation stack operations",
@@ -59,54 +101,152 @@ var manageStacksCmd = &cobra.Command{
 	modified and/or deleted. For each change, the corresponding AWS CloudFormation
 	stack operation is invoked. For new files, create-stack, for updated files, 
 	update-stack, and for deleted files, delete-stack.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 
-		gitParser := gitformation.NewLocalRepoParser(App.Logger, Filter)
-		changeSet := gitParser.Diff(CommitHash)
+		gitParser, err := newGitParser()
+		if err != nil {
+			return err
+		}
+		defer gitParser.Close()
 
-		if changeSet == nil {
-			App.Logger.Fatal("unexpected git parser error: *git.ChangeSet is nil")
+		if SinceLastDeploy {
+			if err := fromLastDeploy(gitParser); err != nil {
+				return err
+			}
+			// The marker is only moved once every stack has reached a
+			// terminal status, so every layer must be waited on
+			if !WaitForStackResult {
+				App.Logger.Info("--since-last-deploy waits for every stack operation to finish")
+				WaitForStackResult = true
+			}
 		}
 
-		if DebugFlag {
-			outputChangeSet(OutputFormat, changeSet)
+		if err := checkGuardRules(gitParser, DeploymentEnv, fromRevision(), ToRevision); err != nil {
+			return err
 		}
 
-		var deploymentBucket *cloudformation.DeploymentBucket
-		if DeploymentBucketName != "" {
-			if DeploymentBucketKeyPrefix == "" {
-				argRequiredError("--template-bucket-key")
+		if err := verifySignatures(gitParser); err != nil {
+			return err
+		}
+
+		changeSet, commit, err := diffRevisions(gitParser)
+		if err != nil {
+			return err
+		}
+		changeSet = applyDirectives(changeSet)
+
+		if DebugFlag {
+			if err := outputChangeSet(OutputFormat, changeSet); err != nil {
+				return err
 			}
 		}
 
-		options := &cloudformation.ServiceOptions{
-			Region:                Region,
-			Profile:               Profile,
-			ProfilePrefix:         ProfilePrefix,
-			Environment:           DeploymentEnv,
-			Bucket:                deploymentBucket,
-			Parameters:            DeploymentParameters,
-			ParameterFiles:        ParameterFiles,
-			ParameterFileMappings: ParameterFileMappings,
-			Capabilities:          Capabilities,
-			DisableRollback:       DisableRollback,
-			ExitOnError:           ExitOnError,
-			WaitForStackResult:    WaitForStackResult,
-			DependencyGraph:       DependencyGraph,
-			DryRun:                DryRun}
-
-		cloudformationService := cloudformation.NewCloudFormationService(App.Logger, options)
+		cloudformationService, err := newCloudFormationService(templateReader(gitParser, commit), templateLister(gitParser, commit))
+		if err != nil {
+			return err
+		}
 
 		executor := executor.NewExecutor(
 			App.Logger,
 			&executor.ExecutorOptions{
-				Parallel:    Parallel,
-				ExitOnError: ExitOnError},
+				Parallel:     Parallel,
+				ExitOnError:  ExitOnError,
+				RenamePolicy: executor.RenamePolicy(RenamePolicy)},
 			changeSet,
 			cloudformationService)
 
-		result := executor.Run()
+		result, err := executor.Run()
+		if err != nil {
+			return err
+		}
+
+		if err := outputResult(OutputFormat, result); err != nil {
+			return err
+		}
 
-		outputResult(OutputFormat, result)
+		if SinceLastDeploy {
+			if err := markDeployed(gitParser, commit, changeSet.Directives, result); err != nil {
+				return err
+			}
+		}
+
+		return outcomeError(result)
 	},
 }
+
+// Creates a new CloudFormation service using the stack flags. Templates
+// are read and listed using the passed reader and lister.
+func newCloudFormationService(
+	templateReader cloudformation.TemplateReader,
+	templateLister cloudformation.TemplateLister) (executor.ServiceExecutor, error) {
+
+	var deploymentBucket *cloudformation.DeploymentBucket
+	if DeploymentBucketName != "" {
+		if DeploymentBucketKeyPrefix == "" {
+			return nil, argRequiredError("--template-bucket-key")
+		}
+		deploymentBucket = &cloudformation.DeploymentBucket{
+			BucketName: DeploymentBucketName,
+			KeyPrefix:  DeploymentBucketKeyPrefix,
+			KMSKeyId:   DeploymentBucketKMSKeyId,
+			Endpoint:   S3Endpoint}
+	}
+
+	options := &cloudformation.ServiceOptions{
+		Region:                Region,
+		Profile:               Profile,
+		ProfilePrefix:         ProfilePrefix,
+		Environment:           DeploymentEnv,
+		Bucket:                deploymentBucket,
+		Parameters:            DeploymentParameters,
+		ParameterFiles:        ParameterFiles,
+		ParameterFileMappings: ParameterFileMappings,
+		StackNameMappings:     StackNameMappings,
+		Capabilities:          Capabilities,
+		DisableRollback:       DisableRollback,
+		ExitOnError:           ExitOnError,
+		WaitForStackResult:    WaitForStackResult,
+		DependencyGraph:       DependencyGraph,
+		DryRun:                DryRun,
+		UseChangeSets:         UseChangeSets || ChangeSetCreates,
+		ChangeSetCreates:      ChangeSetCreates,
+		ReviewChangeSet:       reviewChangeSet,
+		TemplateReader:        templateReader,
+		TemplateLister:        templateLister,
+		StackTimeout:          StackTimeout,
+		StreamEvents:          StreamEvents}
+
+	return cloudformation.NewCloudFormationService(App.Logger, options)
+}
+
+var reviewMutex sync.Mutex
+
+// Shared by every prompt so answers buffered from piped
+// input are not lost between change set reviews
+var reviewReader = bufio.NewReader(os.Stdin)
+
+// Prints the resource level changes in a change set to stderr and prompts for
+// confirmation unless --auto-approve is set. Reviews are serialized so
+// prompts for stacks running in parallel do not interleave.
+func reviewChangeSet(changes *executor.StackChanges) bool {
+
+	reviewMutex.Lock()
+	defer reviewMutex.Unlock()
+
+	if err := outputChanges(os.Stderr, OutputFormat, changes); err != nil {
+		App.Logger.Error(err)
+		return false
+	}
+
+	if AutoApprove {
+		return true
+	}
+
+	fmt.Fprintf(os.Stderr, "Execute change set %s for stack %s? [y/N]: ", changes.ChangeSetName, changes.StackName)
+	answer, err := reviewReader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	"github.com/jeremyhahn/gitformation/internal/plan"
+	"github.com/spf13/cobra"
+)
+
+var PlanOutputFile string
+
+func init() {
+
+	addStackFlags(planCmd)
+
+	planCmd.PersistentFlags().StringVarP(&PlanOutputFile, "out", "o", "plan.json", "File to write the execution plan to")
+
+	rootCmd.AddCommand(planCmd)
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Writes a reviewable execution plan for the last git commit",
+	Long: `Parses the last git commit to determine which files have been created,
+	modified and/or deleted, resolves the stack names, parameters, capabilities
+	and dependency ordering for each change, and writes a versioned plan file
+	describing every intended create, update and delete. The plan can be reviewed
+	and then executed with the apply command.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		gitParser, err := newGitParser()
+		if err != nil {
+			return err
+		}
+		defer gitParser.Close()
+
+		changeSet, commit, err := diffRevisions(gitParser)
+		if err != nil {
+			return err
+		}
+		changeSet = applyDirectives(changeSet)
+
+		cloudformationService, err := newCloudFormationService(templateReader(gitParser, commit), templateLister(gitParser, commit))
+		if err != nil {
+			return err
+		}
+
+		executor := executor.NewExecutor(
+			App.Logger,
+			&executor.ExecutorOptions{
+				RenamePolicy: executor.RenamePolicy(RenamePolicy)},
+			changeSet,
+			cloudformationService)
+
+		p, err := executor.Plan()
+		if err != nil {
+			return err
+		}
+		p.Commit = commit
+		p.Ref = ToRevision
+		p.Uncommitted = uncommitted()
+		p.Environment = DeploymentEnv
+		p.Region = Region
+		p.Profile = Profile
+		p.ProfilePrefix = ProfilePrefix
+		p.TemplateBucket = DeploymentBucketName
+		p.TemplateBucketKeyPrefix = DeploymentBucketKeyPrefix
+		p.TemplateBucketKMSKeyId = DeploymentBucketKMSKeyId
+
+		if err := p.Save(PlanOutputFile); err != nil {
+			return err
+		}
+
+		printPlan(p)
+		return nil
+	},
+}
+
+// Prints a summary of the planned operations for review
+func printPlan(p *plan.Plan) {
+	App.Logger.Infof("plan for commit %s (env: %s, region: %s)", p.Commit, p.Environment, p.Region)
+	if p.Uncommitted {
+		App.Logger.Warning("plan includes uncommitted changes and cannot be applied")
+	}
+	for _, op := range p.Operations {
+		if op.TriggeredBy != "" {
+			App.Logger.Infof("layer %d: %s %s (%s, triggered by %s)", op.Layer+1, op.Action, op.StackName, op.FilePath, op.TriggeredBy)
+			continue
+		}
+		App.Logger.Infof("layer %d: %s %s (%s)", op.Layer+1, op.Action, op.StackName, op.FilePath)
+	}
+	App.Logger.Infof("plan written to %s (checksum: %s)", PlanOutputFile, p.Checksum)
+}
@@ -1,8 +1,9 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/signal"
 	"runtime"
@@ -30,6 +31,12 @@ var DataDir string
 var LogDir string
 var LogFile string
 var HomeDir string
+var OutputFile string
+
+// Where formatted output is written. Logs are written to stderr so
+// the output can be piped to other programs.
+var outputWriter io.Writer = os.Stdout
+var outputFile *os.File
 
 var rootCmd = &cobra.Command{
 	Use:   app.Name,
@@ -40,12 +47,14 @@ and/or deleted since the last commit. For each change, the corresponding AWS
 CloudFormation stack operation is executed. For new files, create-stack, 
 updated files, update-stack, and deleted files, delete-stack.`,
 
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		//initApp()
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return openOutputFile()
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 	},
 	TraverseChildren: true,
+	SilenceUsage:     true,
+	SilenceErrors:    true,
 }
 
 func init() {
@@ -63,10 +72,28 @@ func init() {
 	}
 }
 
+// Executes the requested command, printing any returned error to
+// stderr and exiting with the exit code for the outcome of the run.
 func Execute() error {
-	if err := rootCmd.Execute(); err != nil {
-		log.Fatal(err)
+	err := rootCmd.Execute()
+	if outputFile != nil {
+		if closeErr := outputFile.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	code := ExitFailure
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		code = exitErr.code
+		err = exitErr.err
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 	}
+	os.Exit(code)
 	return nil
 }
 
@@ -89,8 +116,8 @@ func initApp() {
 func initLogger() {
 	App.LogDir = LogDir
 	App.LogFile = LogFile
-	stdout := logging.NewLogBackend(os.Stdout, "", 0)
-	logging.SetBackend(stdout)
+	stderr := logging.NewLogBackend(os.Stderr, "", 0)
+	logging.SetBackend(stderr)
 	if App.DebugFlag {
 		logging.SetLevel(logging.DEBUG, "")
 	} else {
@@ -119,28 +146,75 @@ func initConfig() {
 	App.Logger.Debugf("%+v", App)
 }
 
-func argRequiredError(arg string) {
-	App.Logger.Fatalf("%s argument required ", arg)
+// Redirects formatted output to the --output-file, if set
+func openOutputFile() error {
+	if OutputFile == "" {
+		return nil
+	}
+	file, err := os.Create(OutputFile)
+	if err != nil {
+		return err
+	}
+	outputFile = file
+	outputWriter = file
+	return nil
+}
+
+// Adds the flags that control the formatted output of a command
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&OutputFormat, "format", "human", "The output format to use (human | json | yaml | table)")
+	cmd.PersistentFlags().StringVar(&OutputFile, "output-file", "", "Write the formatted output to a file instead of stdout")
+}
+
+func argRequiredError(arg string) error {
+	return fmt.Errorf("%s argument required", arg)
+}
+
+func unsupportedFormatError(output string) error {
+	return fmt.Errorf("unsupported --format option: %s", output)
+}
+
+func outputChangeSet(output string, changeSet *git.ChangeSet) error {
+	switch output {
+	case "human":
+		return changeset.NewHumanFormat(outputWriter, changeSet).PrintChangeSet()
+	case "json":
+		return changeset.NewJsonFormat(outputWriter, changeSet).PrintChangeSet()
+	case "yaml":
+		return changeset.NewYamlFormat(outputWriter, changeSet).PrintChangeSet()
+	case "table":
+		return changeset.NewTableFormat(outputWriter, changeSet).PrintChangeSet()
+	}
+	return unsupportedFormatError(output)
 }
 
-func outputChangeSet(output string, changeSet *git.ChangeSet) {
+func outputResult(output string, result *executor.ExecutionResult) error {
 	switch output {
 	case "human":
-		changeset.NewHumanFormat(App.Logger, changeSet).PrintChangeSet()
+		return execution.NewHumanFormat(outputWriter, result).PrintResult()
 	case "json":
-		changeset.NewJsonFormat(App.Logger, changeSet).PrintChangeSet()
-	default:
-		App.Logger.Fatalf("unsupported --format option: %s", output)
+		return execution.NewJsonFormat(outputWriter, result).PrintResult()
+	case "yaml":
+		return execution.NewYamlFormat(outputWriter, result).PrintResult()
+	case "table":
+		return execution.NewTableFormat(outputWriter, result).PrintResult()
 	}
+	return unsupportedFormatError(output)
 }
 
-func outputResult(output string, result *executor.ExecutionResult) {
+// Prints the changes in a change set to the writer. Reviews are not part
+// of the formatted result, so they are written next to the prompt rather
+// than to the outputWriter.
+func outputChanges(writer io.Writer, output string, changes *executor.StackChanges) error {
 	switch output {
 	case "human":
-		execution.NewHumanFormat(App.Logger, result).PrintResult()
+		return execution.NewHumanChangesFormat(writer, changes).PrintChanges()
 	case "json":
-		execution.NewJsonFormat(App.Logger, result).PrintResult()
-	default:
-		App.Logger.Fatalf("unsupported --format option: %s", output)
+		return execution.NewJsonChangesFormat(writer, changes).PrintChanges()
+	case "yaml":
+		return execution.NewYamlChangesFormat(writer, changes).PrintChanges()
+	case "table":
+		return execution.NewTableChangesFormat(writer, changes).PrintChanges()
 	}
+	return unsupportedFormatError(output)
 }
@@ -0,0 +1,26 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidPlan         = errors.New("invalid plan")
+	ErrInvalidRenamePolicy = errors.New("invalid rename policy")
+)
+
+// Returned when a stack operation finishes in a failed or rolled back
+// state. The reason, when known, explains why the operation failed.
+type StackStatusError struct {
+	StackName string
+	Status    string
+	Reason    string
+}
+
+func (e *StackStatusError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("stack %s finished with status %s: %s", e.StackName, e.Status, e.Reason)
+	}
+	return fmt.Sprintf("stack %s finished with status %s", e.StackName, e.Status)
+}
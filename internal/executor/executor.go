@@ -1,9 +1,14 @@
 package executor
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/jeremyhahn/gitformation/internal/git"
+	"github.com/jeremyhahn/gitformation/internal/plan"
 	"github.com/op/go-logging"
 	"golang.org/x/exp/maps"
 )
@@ -13,7 +18,6 @@ type Executor struct {
 	options   *ExecutorOptions
 	changeSet *git.ChangeSet
 	service   ServiceExecutor
-	hasErrors bool
 	ChangeSetExecutor
 }
 
@@ -33,114 +37,344 @@ func NewExecutor(
 		service:   service}
 }
 
-// Executes create, update, and delete operations for
+// Plans and executes create, update, and delete operations for
 // each file in the changeset.
-func (e *Executor) Run() *ExecutionResult {
-	return &ExecutionResult{
+func (e *Executor) Run() (*ExecutionResult, error) {
+	p, err := e.Plan()
+	if err != nil {
+		return nil, err
+	}
+	return e.Apply(p)
+}
+
+// Builds an execution plan for the changeset. Create and update operations
+// are scheduled one dependency layer at a time, followed by delete operations
+// in reverse layer order so a stack is never deleted before its dependents.
+// Renamed files are planned according to the rename policy. Each operation
+// is resolved by the service so the plan describes exactly what will be
+// sent to the service when the plan is applied.
+func (e *Executor) Plan() (*plan.Plan, error) {
+
+	p := plan.NewPlan(e.service.Name())
+
+	// Let the service add the files affected by related
+	// changes, such as parameters files.
+	changeSet, err := e.service.ResolveChanges(e.changeSet)
+	if err != nil {
+		return nil, err
+	}
+
+	created := make(map[string]bool, len(changeSet.Created))
+	for _, file := range changeSet.Created {
+		created[file] = true
+	}
+
+	changed := make([]string, 0, len(changeSet.Created)+len(changeSet.Updated))
+	changed = append(changed, changeSet.Created...)
+	changed = append(changed, changeSet.Updated...)
+
+	deleted := make([]string, 0, len(changeSet.Deleted))
+	deleted = append(deleted, changeSet.Deleted...)
+
+	// The file each renamed file was renamed from, for
+	// renames that keep the stack of the old file.
+	renamedFrom := make(map[string]string)
+
+	for _, rename := range changeSet.Renamed {
+		switch e.options.RenamePolicy {
+		case RenamePolicyKeep, RenamePolicyReplace, "":
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRenamePolicy, e.options.RenamePolicy)
+		}
+		// A move that keeps the same stack name is always an update. Replacing
+		// it would create a stack that already exists, then delete it.
+		if e.options.RenamePolicy == RenamePolicyKeep ||
+			e.service.StackName(rename.From) == e.service.StackName(rename.To) {
+			renamedFrom[rename.To] = rename.From
+		} else {
+			created[rename.To] = true
+			deleted = append(deleted, rename.From)
+		}
+		changed = append(changed, rename.To)
+	}
+
+	// Only deploy the stacks listed in a Deploy-Only commit trailer
+	if directives := changeSet.Directives; directives.IsScoped() {
+		skip := func(file string) bool {
+			stackName := e.service.StackName(file)
+			if from, ok := renamedFrom[file]; ok {
+				stackName = e.service.StackName(from)
+			}
+			if directives.DeploysStack(stackName) {
+				return false
+			}
+			e.logger.Infof("Skipping %s, stack %s is not listed in %s", file, stackName, git.DeployOnlyTrailer)
+			return true
+		}
+		changed = slices.DeleteFunc(changed, skip)
+		deleted = slices.DeleteFunc(deleted, skip)
+	}
+
+	layers := e.service.ExecutionLayers(changed)
+	deleteLayers := e.service.ExecutionLayers(deleted)
+	slices.Reverse(deleteLayers)
+
+	for i, layer := range layers {
+		for _, file := range layer {
+			actionType := git.Update
+			if created[file] {
+				actionType = git.Insert
+			}
+			op, err := e.service.PlanOperation(actionType, file)
+			if err != nil {
+				return nil, err
+			}
+			if from, ok := renamedFrom[file]; ok {
+				e.keepStackName(op, from)
+			}
+			op.TriggeredBy = changeSet.Triggered[file]
+			op.Layer = i
+			p.Operations = append(p.Operations, op)
+		}
+	}
+
+	for i, layer := range deleteLayers {
+		for _, file := range layer {
+			op, err := e.service.PlanOperation(git.Delete, file)
+			if err != nil {
+				return nil, err
+			}
+			op.Layer = len(layers) + i
+			p.Operations = append(p.Operations, op)
+		}
+	}
+
+	return p, nil
+}
+
+// Updates the stack of a renamed file's previous path, instead of the
+// stack the service would use for the new path.
+func (e *Executor) keepStackName(op *plan.Operation, from string) {
+	op.RenamedFrom = from
+	stackName := e.service.StackName(from)
+	if op.StackName != stackName {
+		e.logger.Warningf("%s was renamed from %s, updating stack %s instead of %s; "+
+			"map %s to stack %s to keep using this stack after this deployment",
+			op.FilePath, from, stackName, op.StackName, op.FilePath, stackName)
+		op.StackName = stackName
+	}
+}
+
+// Executes the operations in a plan one layer at a time. Operations
+// within a layer run in parallel (when enabled), and each layer must
+// reach a terminal state before the next layer begins. Returns an error
+// without executing anything if the plan contains an unknown action.
+func (e *Executor) Apply(p *plan.Plan) (*ExecutionResult, error) {
+
+	for _, op := range p.Operations {
+		if _, err := git.ParseActionType(op.Action); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidPlan, op.FilePath, err)
+		}
+	}
+
+	result := &ExecutionResult{
 		ServiceName:   e.service.Name(),
-		HasErrors:     e.hasErrors,
-		CreateResults: e.Create(e.changeSet.Created),
-		UpdateResults: e.Update(e.changeSet.Updated),
-		DeleteResults: e.Delete(e.changeSet.Deleted)}
+		CreateResults: NewOperationResult(),
+		UpdateResults: NewOperationResult(),
+		DeleteResults: NewOperationResult()}
+
+	layers := p.Layers()
+
+	for i, layer := range layers {
+		if e.options.ExitOnError && result.HasErrors {
+			break
+		}
+
+		e.logger.Debugf("executing %s layer %d of %d", e.service.Name(), i+1, len(layers))
+
+		creates := make([]*plan.Operation, 0, len(layer))
+		updates := make([]*plan.Operation, 0, len(layer))
+		deletes := make([]*plan.Operation, 0, len(layer))
+		for _, op := range layer {
+			switch op.Action {
+			case git.Insert.String():
+				creates = append(creates, op)
+			case git.Update.String():
+				updates = append(updates, op)
+			case git.Delete.String():
+				deletes = append(deletes, op)
+			}
+		}
+
+		// Wait for the stacks in this layer to finish before
+		// moving on if any other layers are left to process.
+		wait := i < len(layers)-1
+
+		var createResult, updateResult, deleteResult *OperationResult
+		if e.options.Parallel {
+			var wg sync.WaitGroup
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				createResult = e.Execute(git.Insert, creates, wait, e.service.Create)
+			}()
+			go func() {
+				defer wg.Done()
+				updateResult = e.Execute(git.Update, updates, wait, e.service.Update)
+			}()
+			go func() {
+				defer wg.Done()
+				deleteResult = e.Execute(git.Delete, deletes, wait, e.service.Delete)
+			}()
+			wg.Wait()
+		} else {
+			// Run one operation at a time, as --parallel=false promises.
+			createResult = e.Execute(git.Insert, creates, wait, e.service.Create)
+			updateResult = e.Execute(git.Update, updates, wait, e.service.Update)
+			deleteResult = e.Execute(git.Delete, deletes, wait, e.service.Delete)
+		}
+
+		result.CreateResults.Merge(createResult)
+		result.UpdateResults.Merge(updateResult)
+		result.DeleteResults.Merge(deleteResult)
+		result.HasErrors = result.HasErrors ||
+			len(createResult.Errors) > 0 ||
+			len(updateResult.Errors) > 0 ||
+			len(deleteResult.Errors) > 0
+	}
+
+	result.Summary = NewSummary(p, result)
+
+	return result, nil
 }
 
-// Perform a create operation for each file in the changeset
-func (executor *Executor) Create(creates []string) *OperationResult {
-	return executor.Execute(git.Insert, creates, executor.service.Create)
+// Perform a create operation for each planned create
+func (executor *Executor) Create(creates []*plan.Operation) *OperationResult {
+	return executor.Execute(git.Insert, creates, false, executor.service.Create)
 }
 
-// Perform an update operation for each deleted file in the changeset
-func (executor *Executor) Update(updates []string) *OperationResult {
-	return executor.Execute(git.Update, updates, executor.service.Update)
+// Perform an update operation for each planned update
+func (executor *Executor) Update(updates []*plan.Operation) *OperationResult {
+	return executor.Execute(git.Update, updates, false, executor.service.Update)
 }
 
-// Perform a delete operation for each deleted file in the changeset
-func (executor *Executor) Delete(deletes []string) *OperationResult {
-	return executor.Execute(git.Delete, deletes, executor.service.Delete)
+// Perform a delete operation for each planned delete
+func (executor *Executor) Delete(deletes []*plan.Operation) *OperationResult {
+	return executor.Execute(git.Delete, deletes, false, executor.service.Delete)
 }
 
 // Execute the desired action (create, update, delete) using the passed
-// options for parallelism and exit behavior.
-func (executor *Executor) Execute(actionType git.ActionType, files []string,
-	execFunc OperationExecFunc) *OperationResult {
+// options for parallelism and exit behavior. When wait is true, the service
+// blocks until each operation reaches a terminal state. The result of each
+// operation is recorded as soon as it returns, so with ExitOnError no
+// further operations are started once one has failed.
+func (executor *Executor) Execute(actionType git.ActionType, operations []*plan.Operation,
+	wait bool, execFunc OperationExecFunc) *OperationResult {
 
 	var wg sync.WaitGroup
+	var mutex sync.Mutex
 
-	fileLen := len(files)
-	responses := make(map[string]string, fileLen)
-	errors := make(map[string]error, fileLen)
+	result := NewOperationResult()
 
-	responseChan := make(chan map[string]string, fileLen)
-	errorChan := make(chan map[string]error, fileLen)
-	doneChan := make(chan bool, 1)
+	failed := func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(result.Errors) > 0
+	}
 
-	go executor.listen(actionType, responseChan, errorChan, responses, errors, doneChan)
+	run := func(op *plan.Operation) {
+		started := time.Now()
+		response, err := executor.executeOperation(op, wait, execFunc)
+		mutex.Lock()
+		defer mutex.Unlock()
+		executor.record(actionType, result, op, response, err, time.Since(started).Round(time.Second))
+	}
 
-	for _, filePath := range files {
-		// Should have aborted by now if ExitOnError is true,
-		// but putting this here for a safeguard to stop
-		// executing jobs as soon as an error is seen.
-		if executor.options.ExitOnError && len(errors) > 0 {
+	for _, op := range operations {
+		if executor.options.ExitOnError && failed() {
 			break
 		}
-		wg.Add(1)
+		mutex.Lock()
+		result.StackNames[op.FilePath] = op.StackName
+		mutex.Unlock()
 		if executor.options.Parallel {
 			executor.logger.Debugf("executing asyncronous %s %s operation on %s",
-				executor.service.Name(), actionType.String(), filePath)
-			go execFunc(&ServiceParams{
-				FilePath:     filePath,
-				ResponseChan: responseChan,
-				ErrorChan:    errorChan,
-				WaitGroup:    &wg})
+				executor.service.Name(), actionType.String(), op.FilePath)
+			wg.Add(1)
+			go func(op *plan.Operation) {
+				defer wg.Done()
+				run(op)
+			}(op)
 		} else {
 			executor.logger.Debugf("executing synchronous %s %s operation on %s",
-				executor.service.Name(), actionType.String(), filePath)
-			execFunc(&ServiceParams{
-				FilePath:     filePath,
-				ResponseChan: responseChan,
-				ErrorChan:    errorChan,
-				WaitGroup:    &wg})
+				executor.service.Name(), actionType.String(), op.FilePath)
+			run(op)
 		}
 	}
 
 	wg.Wait()
-	doneChan <- true
 
 	executor.logger.Debugf("%s %s operations complete", executor.service.Name(), actionType.String())
 
-	return NewOperationResult(responses, errors)
+	return result
+}
+
+// Runs a single operation and returns the response or error the service
+// sent for it. The service signals completion through the wait group, so
+// the result is known before this returns.
+func (executor *Executor) executeOperation(
+	op *plan.Operation,
+	wait bool,
+	execFunc OperationExecFunc) (*OperationResponse, error) {
+
+	var wg sync.WaitGroup
+	responseChan := make(chan *OperationResponse, 1)
+	errorChan := make(chan map[string]error, 1)
+
+	wg.Add(1)
+	execFunc(&ServiceParams{
+		Operation:    op,
+		Wait:         wait,
+		ResponseChan: responseChan,
+		ErrorChan:    errorChan,
+		WaitGroup:    &wg})
+	wg.Wait()
+
+	select {
+	case response := <-responseChan:
+		return response, nil
+	case err := <-errorChan:
+		return nil, maps.Values(err)[0]
+	default:
+		return nil, fmt.Errorf("%s %s operation on %s did not report a result",
+			executor.service.Name(), op.Action, op.FilePath)
+	}
 }
 
-// Listen for responses and errors from the service
-func (executor *Executor) listen(
+// Records the response or error of an operation in the result
+func (executor *Executor) record(
 	actionType git.ActionType,
-	responseChan chan map[string]string,
-	errorChan chan map[string]error,
-	responses map[string]string,
-	errors map[string]error,
-	doneChan chan bool) {
-
-	processing := true
-	for processing {
-		select {
-		case response := <-responseChan:
-			responses[maps.Keys(response)[0]] = maps.Values(response)[0]
-		case err := <-errorChan:
-			errors[maps.Keys(err)[0]] = maps.Values(err)[0]
-			executor.hasErrors = true
-			if executor.options.ExitOnError {
-				executor.logger.Fatalf("%s %s encountered an error: %s", executor.service.Name(), actionType.String(), err)
-			}
-			executor.logger.Errorf("%s %s encountered an error: %s", executor.service.Name(), actionType.String(), err)
-		case <-doneChan:
-			executor.logger.Debugf("Done with %s %s operations complete. Closing response and error channels.",
-				executor.service.Name(), actionType.String())
-			processing = false
-			close(responseChan)
-			close(errorChan)
-			close(doneChan)
+	result *OperationResult,
+	op *plan.Operation,
+	response *OperationResponse,
+	err error,
+	duration time.Duration) {
+
+	result.Durations[op.FilePath] = duration
+	if err != nil {
+		result.Errors[op.FilePath] = err
+		var statusErr *StackStatusError
+		if errors.As(err, &statusErr) {
+			result.Statuses[op.FilePath] = statusErr.Status
 		}
+		executor.logger.Errorf("%s %s encountered an error: %s: %s",
+			executor.service.Name(), actionType.String(), op.FilePath, err)
+		return
 	}
-
-	executor.logger.Debugf("%s %s channel listener exiting", executor.service.Name(), actionType.String())
+	if response.Unchanged {
+		result.Unchanged[op.FilePath] = response.StackName
+		return
+	}
+	result.Responses[op.FilePath] = response.StackId
+	result.Statuses[op.FilePath] = response.Status
 }
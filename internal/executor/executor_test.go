@@ -0,0 +1,355 @@
+package executor
+
+import (
+	"errors"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeremyhahn/gitformation/internal/git"
+	"github.com/jeremyhahn/gitformation/internal/plan"
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// A service that plans operations without executing them
+type planningService struct {
+	stackNames map[string]string
+}
+
+func (s *planningService) Name() string {
+	return "test"
+}
+
+func (s *planningService) StackName(filePath string) string {
+	if name, ok := s.stackNames[filePath]; ok {
+		return name
+	}
+	return strings.TrimSuffix(path.Base(filePath), path.Ext(filePath))
+}
+
+func (s *planningService) ExecutionLayers(files []string) [][]string {
+	if len(files) == 0 {
+		return nil
+	}
+	return [][]string{files}
+}
+
+func (s *planningService) ResolveChanges(changeSet *git.ChangeSet) (*git.ChangeSet, error) {
+	return changeSet, nil
+}
+
+func (s *planningService) PlanOperation(actionType git.ActionType, filePath string) (*plan.Operation, error) {
+	return &plan.Operation{
+		Action:    actionType.String(),
+		FilePath:  filePath,
+		StackName: s.StackName(filePath)}, nil
+}
+
+func (s *planningService) Create(serviceParams *ServiceParams) {}
+func (s *planningService) Update(serviceParams *ServiceParams) {}
+func (s *planningService) Delete(serviceParams *ServiceParams) {}
+
+func newRenameExecutor(policy RenamePolicy, stackNames map[string]string) ChangeSetExecutor {
+	changeSet := git.NewChangeSet(nil, nil, nil, []*git.Rename{
+		{From: "templates/vpc.template", To: "templates/network.template"}})
+	return NewExecutor(
+		logging.MustGetLogger("test"),
+		&ExecutorOptions{RenamePolicy: policy},
+		changeSet,
+		&planningService{stackNames: stackNames})
+}
+
+func TestPlanRenameReplacesStack(t *testing.T) {
+	p, err := newRenameExecutor(RenamePolicyReplace, nil).Plan()
+	assert.NoError(t, err)
+	assert.Len(t, p.Operations, 2)
+	assert.Equal(t, "create", p.Operations[0].Action)
+	assert.Equal(t, "network", p.Operations[0].StackName)
+	assert.Equal(t, "delete", p.Operations[1].Action)
+	assert.Equal(t, "vpc", p.Operations[1].StackName)
+}
+
+func TestPlanRenameKeepsStack(t *testing.T) {
+	p, err := newRenameExecutor(RenamePolicyKeep, nil).Plan()
+	assert.NoError(t, err)
+	assert.Len(t, p.Operations, 1)
+	assert.Equal(t, "update", p.Operations[0].Action)
+	assert.Equal(t, "templates/network.template", p.Operations[0].FilePath)
+	assert.Equal(t, "vpc", p.Operations[0].StackName)
+	assert.Equal(t, "templates/vpc.template", p.Operations[0].RenamedFrom)
+
+	// Stack names are resolved through the service mappings
+	p, err = newRenameExecutor(RenamePolicyKeep, map[string]string{
+		"templates/network.template": "core-vpc",
+		"templates/vpc.template":     "core-vpc"}).Plan()
+	assert.NoError(t, err)
+	assert.Equal(t, "core-vpc", p.Operations[0].StackName)
+}
+
+func TestPlanRenameSameStackName(t *testing.T) {
+	changeSet := git.NewChangeSet(nil, nil, nil, []*git.Rename{
+		{From: "templates/vpc.template", To: "stacks/vpc.template"}})
+
+	for _, policy := range []RenamePolicy{RenamePolicyReplace, RenamePolicyKeep} {
+		p, err := NewExecutor(
+			logging.MustGetLogger("test"),
+			&ExecutorOptions{RenamePolicy: policy},
+			changeSet,
+			&planningService{}).Plan()
+		assert.NoError(t, err)
+		assert.Len(t, p.Operations, 1, policy)
+		assert.Equal(t, "update", p.Operations[0].Action)
+		assert.Equal(t, "stacks/vpc.template", p.Operations[0].FilePath)
+		assert.Equal(t, "vpc", p.Operations[0].StackName)
+		assert.Equal(t, "templates/vpc.template", p.Operations[0].RenamedFrom)
+	}
+}
+
+func TestPlanRejectsInvalidRenamePolicy(t *testing.T) {
+	_, err := newRenameExecutor("bogus", nil).Plan()
+	assert.ErrorIs(t, err, ErrInvalidRenamePolicy)
+}
+
+func TestPlanRecordsTriggeredBy(t *testing.T) {
+	changeSet := git.NewChangeSet(nil, []string{"templates/vpc.template", "templates/web.template"}, nil, nil)
+	changeSet.Triggered = map[string]string{"templates/vpc.template": "parameters/nonprod/vpc.parameters"}
+
+	p, err := NewExecutor(
+		logging.MustGetLogger("test"),
+		&ExecutorOptions{},
+		changeSet,
+		&planningService{}).Plan()
+	assert.NoError(t, err)
+	assert.Len(t, p.Operations, 2)
+	assert.Equal(t, "parameters/nonprod/vpc.parameters", p.Operations[0].TriggeredBy)
+	assert.Empty(t, p.Operations[1].TriggeredBy)
+}
+
+func TestPlanDeployOnly(t *testing.T) {
+	changeSet := git.NewChangeSet(
+		[]string{"templates/iam.template"},
+		[]string{"templates/vpc.template", "templates/web.template"},
+		[]string{"templates/db.template"},
+		nil)
+	changeSet.Directives = &git.Directives{DeployOnly: []string{"vpc", "iam"}}
+
+	p, err := NewExecutor(
+		logging.MustGetLogger("test"),
+		&ExecutorOptions{},
+		changeSet,
+		&planningService{}).Plan()
+	assert.NoError(t, err)
+	assert.Len(t, p.Operations, 2)
+	assert.Equal(t, "iam", p.Operations[0].StackName)
+	assert.Equal(t, "vpc", p.Operations[1].StackName)
+}
+
+// An operation executed by the recordingService
+type call struct {
+	action string
+	file   string
+	wait   bool
+	done   bool
+}
+
+// A service that records the order operations start and finish in. Files
+// are layered by the layers map, and files in the failures map return an
+// error.
+type recordingService struct {
+	planningService
+	layers   map[string]int
+	failures map[string]bool
+	mu       sync.Mutex
+	calls    []call
+}
+
+func (s *recordingService) ExecutionLayers(files []string) [][]string {
+	byLayer := make(map[int][]string)
+	indexes := make([]int, 0)
+	for _, file := range files {
+		layer := s.layers[file]
+		if _, ok := byLayer[layer]; !ok {
+			indexes = append(indexes, layer)
+		}
+		byLayer[layer] = append(byLayer[layer], file)
+	}
+	slices.Sort(indexes)
+	layers := make([][]string, len(indexes))
+	for i, index := range indexes {
+		layers[i] = byLayer[index]
+	}
+	return layers
+}
+
+func (s *recordingService) record(c call) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, c)
+}
+
+func (s *recordingService) execute(action string, serviceParams *ServiceParams) {
+	defer serviceParams.WaitGroup.Done()
+	op := serviceParams.Operation
+	s.record(call{action: action, file: op.FilePath, wait: serviceParams.Wait})
+	// Leave time for a later layer to start if it was not waited on
+	time.Sleep(10 * time.Millisecond)
+	s.record(call{action: action, file: op.FilePath, wait: serviceParams.Wait, done: true})
+	if s.failures[op.FilePath] {
+		serviceParams.ErrorChan <- map[string]error{op.FilePath: errors.New("failed")}
+		return
+	}
+	serviceParams.ResponseChan <- &OperationResponse{
+		FilePath:  op.FilePath,
+		StackName: op.StackName,
+		StackId:   op.StackName + "-id",
+		Status:    strings.ToUpper(action) + "_COMPLETE"}
+}
+
+func (s *recordingService) Create(serviceParams *ServiceParams) {
+	s.execute("create", serviceParams)
+}
+
+func (s *recordingService) Update(serviceParams *ServiceParams) {
+	s.execute("update", serviceParams)
+}
+
+func (s *recordingService) Delete(serviceParams *ServiceParams) {
+	s.execute("delete", serviceParams)
+}
+
+// Returns the files in the order their operations started
+func (s *recordingService) started() []string {
+	files := make([]string, 0, len(s.calls))
+	for _, c := range s.calls {
+		if !c.done {
+			files = append(files, c.file)
+		}
+	}
+	return files
+}
+
+func newRecordingService() *recordingService {
+	return &recordingService{
+		layers: map[string]int{
+			"templates/vpc.template":     0,
+			"templates/db.template":      1,
+			"templates/cache.template":   1,
+			"templates/web.template":     2,
+			"templates/old-vpc.template": 0,
+			"templates/old-db.template":  1},
+		failures: make(map[string]bool)}
+}
+
+func applyChanges(t *testing.T, options *ExecutorOptions, service *recordingService) *ExecutionResult {
+	changeSet := git.NewChangeSet(
+		[]string{"templates/vpc.template", "templates/db.template", "templates/cache.template"},
+		[]string{"templates/web.template"},
+		[]string{"templates/old-vpc.template", "templates/old-db.template"},
+		nil)
+	executor := NewExecutor(logging.MustGetLogger("test"), options, changeSet, service)
+	p, err := executor.Plan()
+	assert.NoError(t, err)
+	result, err := executor.Apply(p)
+	assert.NoError(t, err)
+	return result
+}
+
+func TestApplyWaitsForEachLayer(t *testing.T) {
+	service := newRecordingService()
+	result := applyChanges(t, &ExecutorOptions{Parallel: true}, service)
+	assert.False(t, result.HasErrors)
+	assert.Len(t, service.calls, 12)
+
+	// Every operation in a layer finishes before the next layer starts
+	layers := [][]string{
+		{"templates/vpc.template"},
+		{"templates/db.template", "templates/cache.template"},
+		{"templates/web.template"},
+		{"templates/old-db.template"},
+		{"templates/old-vpc.template"}}
+	started := make(map[string]int)
+	finished := make(map[string]int)
+	for i, c := range service.calls {
+		if c.done {
+			finished[c.file] = i
+		} else {
+			started[c.file] = i
+		}
+	}
+	for i := 1; i < len(layers); i++ {
+		for _, previous := range layers[i-1] {
+			for _, file := range layers[i] {
+				assert.Less(t, finished[previous], started[file], "%s started before %s finished", file, previous)
+			}
+		}
+	}
+
+	// Every layer but the last is waited on
+	for _, c := range service.calls {
+		assert.Equal(t, c.file != "templates/old-vpc.template", c.wait, c.file)
+	}
+}
+
+func TestApplyDeletesInReverseLayerOrder(t *testing.T) {
+	service := newRecordingService()
+	applyChanges(t, &ExecutorOptions{}, service)
+
+	started := service.started()
+	assert.Equal(t, []string{"templates/old-db.template", "templates/old-vpc.template"}, started[len(started)-2:])
+	for _, c := range service.calls {
+		if c.file == "templates/old-vpc.template" {
+			assert.Equal(t, "delete", c.action)
+			assert.False(t, c.wait)
+		}
+	}
+}
+
+func TestApplyExitOnError(t *testing.T) {
+	service := newRecordingService()
+	service.failures["templates/db.template"] = true
+	result := applyChanges(t, &ExecutorOptions{ExitOnError: true}, service)
+
+	// No operation starts after the failure, in the layer or the next one
+	assert.True(t, result.HasErrors)
+	assert.Contains(t, result.CreateResults.Errors, "templates/db.template")
+	assert.NotContains(t, service.started(), "templates/cache.template")
+	assert.NotContains(t, service.started(), "templates/web.template")
+	assert.NotContains(t, service.started(), "templates/old-db.template")
+	assert.Contains(t, result.CreateResults.Responses, "templates/vpc.template")
+
+	// Without ExitOnError every layer runs
+	service = newRecordingService()
+	service.failures["templates/db.template"] = true
+	result = applyChanges(t, &ExecutorOptions{}, service)
+	assert.True(t, result.HasErrors)
+	assert.Len(t, service.started(), 6)
+}
+
+func TestApplySerial(t *testing.T) {
+	service := newRecordingService()
+	changeSet := git.NewChangeSet(
+		[]string{"templates/vpc.template", "templates/cache.template"},
+		[]string{"templates/db.template"},
+		[]string{"templates/old-db.template"},
+		nil)
+	executor := NewExecutor(logging.MustGetLogger("test"), &ExecutorOptions{}, changeSet, service)
+	p, err := executor.Plan()
+	assert.NoError(t, err)
+	result, err := executor.Apply(p)
+	assert.NoError(t, err)
+	assert.False(t, result.HasErrors)
+	assert.Len(t, service.calls, 8)
+
+	// Each operation finishes before the next one starts, including
+	// creates and updates in the same layer
+	for i, c := range service.calls {
+		assert.Equal(t, i%2 == 1, c.done, "%s overlapped another operation", c.file)
+		if c.done {
+			assert.Equal(t, service.calls[i-1].file, c.file)
+		}
+	}
+}
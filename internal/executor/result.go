@@ -1,13 +1,64 @@
 package executor
 
+import (
+	"time"
+
+	"github.com/jeremyhahn/gitformation/internal/git"
+)
+
 type OperationResult struct {
-	Responses map[string]string `yaml:"responses" json:"responses" mapstructure:"responses"`
-	Errors    map[string]error  `yaml:"errors" json:"errors" mapstructure:"errors"`
+	Responses  map[string]string        `yaml:"responses" json:"responses" mapstructure:"responses"`
+	Statuses   map[string]string        `yaml:"statuses" json:"statuses" mapstructure:"statuses"`
+	Unchanged  map[string]string        `yaml:"unchanged" json:"unchanged" mapstructure:"unchanged"`
+	Errors     map[string]error         `yaml:"errors" json:"errors" mapstructure:"errors"`
+	StackNames map[string]string        `yaml:"stackNames" json:"stackNames" mapstructure:"stackNames"`
+	Durations  map[string]time.Duration `yaml:"durations" json:"durations" mapstructure:"durations"`
 }
 
-func NewOperationResult(responses map[string]string, errors map[string]error) *OperationResult {
+// Creates an empty operation result. All results are keyed by file path.
+func NewOperationResult() *OperationResult {
 	return &OperationResult{
-		Responses: responses,
-		Errors:    errors,
+		Responses:  make(map[string]string),
+		Statuses:   make(map[string]string),
+		Unchanged:  make(map[string]string),
+		Errors:     make(map[string]error),
+		StackNames: make(map[string]string),
+		Durations:  make(map[string]time.Duration),
+	}
+}
+
+// Returns the operation result for a plan action
+func (result *ExecutionResult) OperationResult(action string) *OperationResult {
+	switch action {
+	case git.Insert.String():
+		return result.CreateResults
+	case git.Update.String():
+		return result.UpdateResults
+	case git.Delete.String():
+		return result.DeleteResults
+	}
+	return nil
+}
+
+// Copies the responses, statuses, unchanged stacks, errors, stack
+// names and durations from another operation result into this result.
+func (result *OperationResult) Merge(other *OperationResult) {
+	for k, v := range other.Responses {
+		result.Responses[k] = v
+	}
+	for k, v := range other.Statuses {
+		result.Statuses[k] = v
+	}
+	for k, v := range other.Unchanged {
+		result.Unchanged[k] = v
+	}
+	for k, v := range other.Errors {
+		result.Errors[k] = v
+	}
+	for k, v := range other.StackNames {
+		result.StackNames[k] = v
+	}
+	for k, v := range other.Durations {
+		result.Durations[k] = v
 	}
 }
@@ -0,0 +1,120 @@
+package executor
+
+import (
+	"strings"
+
+	"github.com/jeremyhahn/gitformation/internal/plan"
+)
+
+// The overall outcome of an execution
+type Outcome string
+
+const (
+	OutcomeSuccess        Outcome = "success"
+	OutcomePartialFailure Outcome = "partial-failure"
+	OutcomeFailure        Outcome = "failure"
+	OutcomeNothingToDo    Outcome = "nothing-to-do"
+)
+
+// The status counted for operations that failed without
+// reporting a stack status, and for operations that were
+// never started because an earlier operation failed.
+const (
+	StatusFailed    = "FAILED"
+	StatusSkipped   = "SKIPPED"
+	StatusUnchanged = "UNCHANGED"
+)
+
+// Counts of the operations in an execution, by action and by status
+type Summary struct {
+	Outcome   Outcome                   `yaml:"outcome" json:"outcome"`
+	Total     int                       `yaml:"total" json:"total"`
+	Succeeded int                       `yaml:"succeeded" json:"succeeded"`
+	Unchanged int                       `yaml:"unchanged" json:"unchanged"`
+	Failed    int                       `yaml:"failed" json:"failed"`
+	Skipped   int                       `yaml:"skipped" json:"skipped"`
+	Actions   map[string]*ActionSummary `yaml:"actions" json:"actions"`
+	Statuses  map[string]int            `yaml:"statuses" json:"statuses"`
+}
+
+// Counts of the operations for a single action
+type ActionSummary struct {
+	Total     int `yaml:"total" json:"total"`
+	Succeeded int `yaml:"succeeded" json:"succeeded"`
+	Unchanged int `yaml:"unchanged" json:"unchanged"`
+	Failed    int `yaml:"failed" json:"failed"`
+	Skipped   int `yaml:"skipped" json:"skipped"`
+}
+
+// Summarizes the result of applying a plan. Every planned operation is
+// counted exactly once, as succeeded, unchanged, failed or skipped.
+func NewSummary(p *plan.Plan, result *ExecutionResult) *Summary {
+
+	summary := &Summary{
+		Actions:  make(map[string]*ActionSummary, 3),
+		Statuses: make(map[string]int)}
+
+	for _, op := range p.Operations {
+
+		actionSummary, ok := summary.Actions[op.Action]
+		if !ok {
+			actionSummary = &ActionSummary{}
+			summary.Actions[op.Action] = actionSummary
+		}
+		actionSummary.Total++
+		summary.Total++
+
+		opResult := result.OperationResult(op.Action)
+		if opResult == nil {
+			continue
+		}
+
+		status := opResult.Statuses[op.FilePath]
+		if _, ok := opResult.Errors[op.FilePath]; ok {
+			actionSummary.Failed++
+			summary.Failed++
+			if status == "" {
+				status = StatusFailed
+			}
+		} else if _, ok := opResult.Unchanged[op.FilePath]; ok {
+			actionSummary.Unchanged++
+			summary.Unchanged++
+			status = StatusUnchanged
+		} else if _, ok := opResult.Responses[op.FilePath]; ok {
+			actionSummary.Succeeded++
+			summary.Succeeded++
+		} else {
+			actionSummary.Skipped++
+			summary.Skipped++
+			status = StatusSkipped
+		}
+		summary.Statuses[status]++
+	}
+
+	summary.Outcome = summary.outcome()
+	return summary
+}
+
+// Returns the outcome of the summarized operations
+func (summary *Summary) outcome() Outcome {
+	switch {
+	case summary.Total == 0:
+		return OutcomeNothingToDo
+	case summary.Failed == 0:
+		return OutcomeSuccess
+	case summary.Succeeded+summary.Unchanged == 0:
+		return OutcomeFailure
+	}
+	return OutcomePartialFailure
+}
+
+// Returns true if any operation was reported before its stack reached a
+// terminal status, such as when the operation was not waited on
+func (summary *Summary) InProgress() bool {
+	for status, count := range summary.Statuses {
+		if count > 0 && strings.HasSuffix(status, "_IN_PROGRESS") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package executor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jeremyhahn/gitformation/internal/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPlan(actions map[string]string) *plan.Plan {
+	p := plan.NewPlan("cloudformation")
+	for file, action := range actions {
+		p.Operations = append(p.Operations, &plan.Operation{Action: action, FilePath: file})
+	}
+	return p
+}
+
+func newTestResult() *ExecutionResult {
+	return &ExecutionResult{
+		CreateResults: NewOperationResult(),
+		UpdateResults: NewOperationResult(),
+		DeleteResults: NewOperationResult()}
+}
+
+func TestSummaryCountsEachOperation(t *testing.T) {
+
+	p := newTestPlan(map[string]string{
+		"vpc.template":    "create",
+		"subnet.template": "update",
+		"rds.template":    "update",
+		"ec2.template":    "delete",
+		"sg.template":     "delete"})
+
+	result := newTestResult()
+	result.CreateResults.Responses["vpc.template"] = "vpc-id"
+	result.CreateResults.Statuses["vpc.template"] = "CREATE_COMPLETE"
+	result.UpdateResults.Unchanged["subnet.template"] = "subnet"
+	result.UpdateResults.Errors["rds.template"] = &StackStatusError{StackName: "rds", Status: "UPDATE_ROLLBACK_COMPLETE"}
+	result.UpdateResults.Statuses["rds.template"] = "UPDATE_ROLLBACK_COMPLETE"
+	result.DeleteResults.Errors["ec2.template"] = errors.New("access denied")
+
+	summary := NewSummary(p, result)
+
+	assert.Equal(t, OutcomePartialFailure, summary.Outcome)
+	assert.Equal(t, 5, summary.Total)
+	assert.Equal(t, 1, summary.Succeeded)
+	assert.Equal(t, 1, summary.Unchanged)
+	assert.Equal(t, 2, summary.Failed)
+	assert.Equal(t, 1, summary.Skipped)
+	assert.Equal(t, &ActionSummary{Total: 2, Unchanged: 1, Failed: 1}, summary.Actions["update"])
+	assert.Equal(t, &ActionSummary{Total: 2, Failed: 1, Skipped: 1}, summary.Actions["delete"])
+	assert.Equal(t, map[string]int{
+		"CREATE_COMPLETE":          1,
+		"UPDATE_ROLLBACK_COMPLETE": 1,
+		StatusUnchanged:            1,
+		StatusFailed:               1,
+		StatusSkipped:              1}, summary.Statuses)
+}
+
+func TestSummaryOutcome(t *testing.T) {
+
+	assert.Equal(t, OutcomeNothingToDo, NewSummary(newTestPlan(nil), newTestResult()).Outcome)
+
+	p := newTestPlan(map[string]string{"vpc.template": "update"})
+
+	result := newTestResult()
+	result.UpdateResults.Unchanged["vpc.template"] = "vpc"
+	assert.Equal(t, OutcomeSuccess, NewSummary(p, result).Outcome)
+
+	result = newTestResult()
+	result.UpdateResults.Errors["vpc.template"] = errors.New("access denied")
+	assert.Equal(t, OutcomeFailure, NewSummary(p, result).Outcome)
+}
+
+func TestSummaryInProgress(t *testing.T) {
+
+	p := newTestPlan(map[string]string{
+		"vpc.template": "create",
+		"rds.template": "update"})
+
+	result := newTestResult()
+	result.CreateResults.Responses["vpc.template"] = "vpc-id"
+	result.CreateResults.Statuses["vpc.template"] = "CREATE_COMPLETE"
+	result.UpdateResults.Responses["rds.template"] = "rds-id"
+	result.UpdateResults.Statuses["rds.template"] = "UPDATE_IN_PROGRESS"
+
+	summary := NewSummary(p, result)
+	assert.Equal(t, OutcomeSuccess, summary.Outcome)
+	assert.True(t, summary.InProgress())
+
+	result.UpdateResults.Statuses["rds.template"] = "UPDATE_COMPLETE"
+	assert.False(t, NewSummary(p, result).InProgress())
+}
@@ -4,23 +4,30 @@ import (
 	"sync"
 
 	"github.com/jeremyhahn/gitformation/internal/git"
+	"github.com/jeremyhahn/gitformation/internal/plan"
 )
 
 type OperationExecFunc func(serviceParams *ServiceParams)
 
 type ServiceExecutor interface {
 	Name() string
+	StackName(filePath string) string
+	ExecutionLayers(files []string) [][]string
+	ResolveChanges(changeSet *git.ChangeSet) (*git.ChangeSet, error)
+	PlanOperation(actionType git.ActionType, filePath string) (*plan.Operation, error)
 	Create(serviceParams *ServiceParams)
 	Update(serviceParams *ServiceParams)
 	Delete(serviceParams *ServiceParams)
 }
 
 type ChangeSetExecutor interface {
-	Run() *ExecutionResult
-	Execute(actionType git.ActionType, files []string, execFunc OperationExecFunc) *OperationResult
-	Create(creates []string) *OperationResult
-	Update(updates []string) *OperationResult
-	Delete(deletes []string) *OperationResult
+	Run() (*ExecutionResult, error)
+	Plan() (*plan.Plan, error)
+	Apply(p *plan.Plan) (*ExecutionResult, error)
+	Execute(actionType git.ActionType, operations []*plan.Operation, wait bool, execFunc OperationExecFunc) *OperationResult
+	Create(creates []*plan.Operation) *OperationResult
+	Update(updates []*plan.Operation) *OperationResult
+	Delete(deletes []*plan.Operation) *OperationResult
 }
 
 type ExecutionResult struct {
@@ -29,16 +36,65 @@ type ExecutionResult struct {
 	CreateResults *OperationResult `yaml:"create" json:"create"`
 	UpdateResults *OperationResult `yaml:"update" json:"update"`
 	DeleteResults *OperationResult `yaml:"delete" json:"delete"`
+	Summary       *Summary         `yaml:"summary" json:"summary"`
 }
 
+// How a renamed template file is deployed
+type RenamePolicy string
+
+const (
+	// Delete the stack for the old file and create a stack for the new file
+	RenamePolicyReplace RenamePolicy = "replace"
+	// Update the stack for the old file using the new file
+	RenamePolicyKeep RenamePolicy = "keep"
+)
+
 type ExecutorOptions struct {
-	Parallel    bool
-	ExitOnError bool
+	Parallel     bool
+	ExitOnError  bool
+	RenamePolicy RenamePolicy
+}
+
+type OperationResponse struct {
+	FilePath  string
+	StackName string
+	StackId   string
+	Status    string
+	Unchanged bool // The stack was already up to date
 }
 
 type ServiceParams struct {
-	FilePath     string
-	ResponseChan chan map[string]string
+	Operation    *plan.Operation
+	Wait         bool
+	ResponseChan chan *OperationResponse
 	ErrorChan    chan map[string]error
 	WaitGroup    *sync.WaitGroup
 }
+
+// Reviews the resource level changes for a stack before they are
+// executed. Returns true if the changes are approved.
+type ChangeSetReviewFunc func(changes *StackChanges) bool
+
+type StackChanges struct {
+	FilePath      string            `yaml:"file" json:"file"`
+	StackName     string            `yaml:"stackName" json:"stackName"`
+	ChangeSetName string            `yaml:"changeSet" json:"changeSet"`
+	Changes       []*ResourceChange `yaml:"changes" json:"changes"`
+}
+
+type ResourceChange struct {
+	Action       string   `yaml:"action" json:"action"`
+	LogicalId    string   `yaml:"logicalId" json:"logicalId"`
+	PhysicalId   string   `yaml:"physicalId,omitempty" json:"physicalId,omitempty"`
+	ResourceType string   `yaml:"resourceType" json:"resourceType"`
+	Replacement  string   `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+	Scope        []string `yaml:"scope,omitempty" json:"scope,omitempty"`
+	Stateful     bool     `yaml:"stateful" json:"stateful"`
+}
+
+// Returns true if the change may replace (destroy and recreate) a
+// resource that holds state, such as a database or bucket.
+func (change *ResourceChange) ReplacesStatefulResource() bool {
+	return change.Stateful &&
+		(change.Action == "Remove" || change.Replacement == "True" || change.Replacement == "Conditional")
+}
@@ -0,0 +1,25 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplacesStatefulResource(t *testing.T) {
+	tests := []struct {
+		change   ResourceChange
+		replaces bool
+	}{
+		{ResourceChange{Action: "Modify", Replacement: "True", Stateful: true}, true},
+		{ResourceChange{Action: "Modify", Replacement: "Conditional", Stateful: true}, true},
+		{ResourceChange{Action: "Remove", Stateful: true}, true},
+		{ResourceChange{Action: "Modify", Replacement: "False", Stateful: true}, false},
+		{ResourceChange{Action: "Add", Stateful: true}, false},
+		{ResourceChange{Action: "Modify", Replacement: "True"}, false},
+		{ResourceChange{Action: "Remove"}, false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.replaces, test.change.ReplacesStatefulResource(), "%+v", test.change)
+	}
+}
@@ -1,36 +1,59 @@
 package changeset
 
 import (
+	"fmt"
+	"io"
 	"strings"
 
 	"github.com/jeremyhahn/gitformation/internal/git"
-	"github.com/op/go-logging"
 )
 
 type HumanFormat struct {
-	logger    *logging.Logger
+	writer    io.Writer
 	changeSet *git.ChangeSet
 	Formatter
 }
 
-func NewHumanFormat(logger *logging.Logger, changeSet *git.ChangeSet) Formatter {
+func NewHumanFormat(writer io.Writer, changeSet *git.ChangeSet) Formatter {
 	return &HumanFormat{
-		logger:    logger,
+		writer:    writer,
 		changeSet: changeSet}
 }
 
-func (formatter *HumanFormat) PrintChangeSet() {
-	formatter.logger.Info("")
-
-	formatter.logger.Info("--- Created ---")
-	formatter.logger.Info(strings.Join(formatter.changeSet.Created[:], "\n"))
-	formatter.logger.Info("")
-
-	formatter.logger.Info("--- Updated ---")
-	formatter.logger.Info(strings.Join(formatter.changeSet.Updated[:], "\n"))
-	formatter.logger.Info("")
-
-	formatter.logger.Info("--- Deleted ---")
-	formatter.logger.Info(strings.Join(formatter.changeSet.Deleted[:], "\n"))
-	formatter.logger.Info("")
+func (formatter *HumanFormat) PrintChangeSet() error {
+	fmt.Fprintln(formatter.writer)
+
+	fmt.Fprintln(formatter.writer, "--- Created ---")
+	fmt.Fprintln(formatter.writer, strings.Join(formatter.changeSet.Created[:], "\n"))
+	fmt.Fprintln(formatter.writer)
+
+	fmt.Fprintln(formatter.writer, "--- Updated ---")
+	fmt.Fprintln(formatter.writer, strings.Join(formatter.changeSet.Updated[:], "\n"))
+	fmt.Fprintln(formatter.writer)
+
+	fmt.Fprintln(formatter.writer, "--- Deleted ---")
+	fmt.Fprintln(formatter.writer, strings.Join(formatter.changeSet.Deleted[:], "\n"))
+	fmt.Fprintln(formatter.writer)
+
+	fmt.Fprintln(formatter.writer, "--- Renamed ---")
+	for _, rename := range formatter.changeSet.Renamed {
+		fmt.Fprintf(formatter.writer, "%s -> %s\n", rename.From, rename.To)
+	}
+	fmt.Fprintln(formatter.writer)
+
+	if len(formatter.changeSet.Submodules) > 0 {
+		fmt.Fprintln(formatter.writer, "--- Submodules ---")
+		for _, submodule := range formatter.changeSet.Submodules {
+			fmt.Fprintf(formatter.writer, "%s: %s -> %s\n", submodule.Path, submodule.From, submodule.To)
+		}
+		fmt.Fprintln(formatter.writer)
+	}
+
+	if !formatter.changeSet.Directives.IsEmpty() {
+		fmt.Fprintln(formatter.writer, "--- Directives ---")
+		fmt.Fprintln(formatter.writer, formatter.changeSet.Directives)
+		fmt.Fprintln(formatter.writer)
+	}
+
+	return nil
 }
@@ -2,27 +2,29 @@ package changeset
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 
 	"github.com/jeremyhahn/gitformation/internal/git"
-	"github.com/op/go-logging"
 )
 
 type JsonFormat struct {
-	logger    *logging.Logger
+	writer    io.Writer
 	changeSet *git.ChangeSet
 	Formatter
 }
 
-func NewJsonFormat(logger *logging.Logger, changeSet *git.ChangeSet) Formatter {
+func NewJsonFormat(writer io.Writer, changeSet *git.ChangeSet) Formatter {
 	return &JsonFormat{
-		logger:    logger,
+		writer:    writer,
 		changeSet: changeSet}
 }
 
-func (formatter *JsonFormat) PrintChangeSet() {
+func (formatter *JsonFormat) PrintChangeSet() error {
 	data, err := json.Marshal(formatter.changeSet)
 	if err != nil {
-		formatter.logger.Fatal(err)
+		return err
 	}
-	formatter.logger.Info(string(data))
+	_, err = fmt.Fprintln(formatter.writer, string(data))
+	return err
 }
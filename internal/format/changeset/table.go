@@ -0,0 +1,39 @@
+package changeset
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/jeremyhahn/gitformation/internal/git"
+)
+
+type TableFormat struct {
+	writer    io.Writer
+	changeSet *git.ChangeSet
+	Formatter
+}
+
+func NewTableFormat(writer io.Writer, changeSet *git.ChangeSet) Formatter {
+	return &TableFormat{
+		writer:    writer,
+		changeSet: changeSet}
+}
+
+func (formatter *TableFormat) PrintChangeSet() error {
+	w := tabwriter.NewWriter(formatter.writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tACTION")
+	for _, file := range formatter.changeSet.Created {
+		fmt.Fprintf(w, "%s\t%s\n", file, git.Insert)
+	}
+	for _, file := range formatter.changeSet.Updated {
+		fmt.Fprintf(w, "%s\t%s\n", file, git.Update)
+	}
+	for _, file := range formatter.changeSet.Deleted {
+		fmt.Fprintf(w, "%s\t%s\n", file, git.Delete)
+	}
+	for _, rename := range formatter.changeSet.Renamed {
+		fmt.Fprintf(w, "%s -> %s\trename\n", rename.From, rename.To)
+	}
+	return w.Flush()
+}
@@ -1,7 +1,7 @@
 package changeset
 
 type Formatter interface {
-	PrintChangeSet()
+	PrintChangeSet() error
 }
 
 //type FormatterFunc func(changeSet *git.ChangeSet)
@@ -0,0 +1,29 @@
+package changeset
+
+import (
+	"io"
+
+	"github.com/jeremyhahn/gitformation/internal/git"
+	"gopkg.in/yaml.v3"
+)
+
+type YamlFormat struct {
+	writer    io.Writer
+	changeSet *git.ChangeSet
+	Formatter
+}
+
+func NewYamlFormat(writer io.Writer, changeSet *git.ChangeSet) Formatter {
+	return &YamlFormat{
+		writer:    writer,
+		changeSet: changeSet}
+}
+
+func (formatter *YamlFormat) PrintChangeSet() error {
+	data, err := yaml.Marshal(formatter.changeSet)
+	if err != nil {
+		return err
+	}
+	_, err = formatter.writer.Write(data)
+	return err
+}
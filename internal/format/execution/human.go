@@ -1,27 +1,34 @@
 package execution
 
 import (
+	"fmt"
+	"io"
+	"strings"
+
 	"github.com/jeremyhahn/gitformation/internal/executor"
-	"github.com/op/go-logging"
 )
 
 type HumanFormat struct {
-	logger *logging.Logger
+	writer io.Writer
 	result *executor.ExecutionResult
 	Formatter
 }
 
 func NewHumanFormat(
-	logger *logging.Logger,
+	writer io.Writer,
 	executionResult *executor.ExecutionResult) Formatter {
 	return &HumanFormat{
-		logger: logger,
+		writer: writer,
 		result: executionResult}
 }
 
-func (formatter *HumanFormat) PrintResult() {
-	formatter.logger.Info("")
-	formatter.logger.Infof("--- RESULT ----")
+func (formatter *HumanFormat) PrintResult() error {
+	fmt.Fprintln(formatter.writer)
+	fmt.Fprintln(formatter.writer, "--- RESULT ----")
+	formatter.printStatuses("create", formatter.result.CreateResults.Statuses)
+	formatter.printStatuses("update", formatter.result.UpdateResults.Statuses)
+	formatter.printStatuses("delete", formatter.result.DeleteResults.Statuses)
+	formatter.printUnchanged("update", formatter.result.UpdateResults.Unchanged)
 	if formatter.result.HasErrors {
 		if len(formatter.result.CreateResults.Errors) > 0 {
 			formatter.printErrors("create", formatter.result.CreateResults.Errors)
@@ -33,12 +40,92 @@ func (formatter *HumanFormat) PrintResult() {
 			formatter.printErrors("delete", formatter.result.DeleteResults.Errors)
 		}
 	}
+	if formatter.result.Summary != nil {
+		formatter.printSummary(formatter.result.Summary)
+	}
+	return nil
+}
+
+func (formatter *HumanFormat) printSummary(summary *executor.Summary) {
+	fmt.Fprintln(formatter.writer)
+	fmt.Fprintln(formatter.writer, "--- SUMMARY ----")
+	fmt.Fprintf(formatter.writer, "outcome: %s, total: %d, succeeded: %d, unchanged: %d, failed: %d, skipped: %d\n",
+		summary.Outcome, summary.Total, summary.Succeeded, summary.Unchanged, summary.Failed, summary.Skipped)
+	for _, action := range sortedKeys(summary.Actions) {
+		counts := summary.Actions[action]
+		fmt.Fprintf(formatter.writer, "action: %s, total: %d, succeeded: %d, unchanged: %d, failed: %d, skipped: %d\n",
+			action, counts.Total, counts.Succeeded, counts.Unchanged, counts.Failed, counts.Skipped)
+	}
+	for _, status := range sortedKeys(summary.Statuses) {
+		fmt.Fprintf(formatter.writer, "status: %s, count: %d\n", status, summary.Statuses[status])
+	}
+}
+
+func (formatter *HumanFormat) printStatuses(actionType string, statuses map[string]string) {
+	for k, v := range statuses {
+		fmt.Fprintf(formatter.writer, "service: %s, action: %s, file: %s, status: %s\n",
+			formatter.result.ServiceName, actionType, k, v)
+	}
+}
+
+func (formatter *HumanFormat) printUnchanged(actionType string, unchanged map[string]string) {
+	for k, v := range unchanged {
+		fmt.Fprintf(formatter.writer, "service: %s, action: %s, file: %s, stack: %s, status: unchanged\n",
+			formatter.result.ServiceName, actionType, k, v)
+	}
 }
 
 func (formatter *HumanFormat) printErrors(actionType string, errors map[string]error) {
 	for k, v := range errors {
-		formatter.logger.Info("")
-		formatter.logger.Infof("service: %s, action: %s, file: %s, error: %s",
+		fmt.Fprintln(formatter.writer)
+		fmt.Fprintf(formatter.writer, "service: %s, action: %s, file: %s, error: %s\n",
 			formatter.result.ServiceName, actionType, k, v)
 	}
 }
+
+type HumanChangesFormat struct {
+	writer  io.Writer
+	changes *executor.StackChanges
+	ChangesFormatter
+}
+
+func NewHumanChangesFormat(
+	writer io.Writer,
+	changes *executor.StackChanges) ChangesFormatter {
+	return &HumanChangesFormat{
+		writer:  writer,
+		changes: changes}
+}
+
+func (formatter *HumanChangesFormat) PrintChanges() error {
+	fmt.Fprintln(formatter.writer)
+	fmt.Fprintf(formatter.writer, "--- CHANGE SET: %s, stack: %s, file: %s ---\n",
+		formatter.changes.ChangeSetName, formatter.changes.StackName, formatter.changes.FilePath)
+	if len(formatter.changes.Changes) == 0 {
+		fmt.Fprintln(formatter.writer, "no resource changes")
+		return nil
+	}
+	for _, change := range formatter.changes.Changes {
+		fmt.Fprintf(formatter.writer, "action: %s, resource: %s, type: %s, replacement: %s, scope: %s\n",
+			change.Action, change.LogicalId, change.ResourceType, change.Replacement,
+			strings.Join(change.Scope, ", "))
+		if change.ReplacesStatefulResource() {
+			fmt.Fprintf(formatter.writer, "WARNING: %s (%s) is a stateful resource and will be %s\n",
+				change.LogicalId, change.ResourceType, replacementVerb(change))
+		} else if change.Replacement == "True" {
+			fmt.Fprintf(formatter.writer, "WARNING: %s (%s) will be replaced\n", change.LogicalId, change.ResourceType)
+		}
+	}
+	return nil
+}
+
+// Describes what happens to a resource that will be removed or replaced
+func replacementVerb(change *executor.ResourceChange) string {
+	switch {
+	case change.Action == "Remove":
+		return "deleted"
+	case change.Replacement == "Conditional":
+		return "conditionally replaced"
+	}
+	return "replaced"
+}
@@ -0,0 +1,30 @@
+package execution
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHumanChangesFormat(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, NewHumanChangesFormat(&buf, newTestChanges()).PrintChanges())
+	assert.Equal(t, "\n"+
+		"--- CHANGE SET: gitformation-1, stack: db, file: templates/db.template ---\n"+
+		"action: Modify, resource: Database, type: AWS::RDS::DBInstance, replacement: True, scope: Properties\n"+
+		"WARNING: Database (AWS::RDS::DBInstance) is a stateful resource and will be replaced\n"+
+		"action: Modify, resource: Bucket, type: AWS::S3::Bucket, replacement: Conditional, scope: Properties\n"+
+		"WARNING: Bucket (AWS::S3::Bucket) is a stateful resource and will be conditionally replaced\n"+
+		"action: Remove, resource: Table, type: AWS::DynamoDB::Table, replacement: , scope: \n"+
+		"WARNING: Table (AWS::DynamoDB::Table) is a stateful resource and will be deleted\n"+
+		"action: Modify, resource: Function, type: AWS::Lambda::Function, replacement: True, scope: Properties, Tags\n"+
+		"WARNING: Function (AWS::Lambda::Function) will be replaced\n"+
+		"action: Modify, resource: Queue, type: AWS::SQS::Queue, replacement: False, scope: Tags\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, NewHumanChangesFormat(&buf, &executor.StackChanges{
+		FilePath: "templates/db.template", StackName: "db", ChangeSetName: "gitformation-1"}).PrintChanges())
+	assert.Contains(t, buf.String(), "no resource changes")
+}
@@ -2,9 +2,10 @@ package execution
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 
 	"github.com/jeremyhahn/gitformation/internal/executor"
-	"github.com/op/go-logging"
 )
 
 type JsonExecutionResult struct {
@@ -13,67 +14,89 @@ type JsonExecutionResult struct {
 	CreateResults *JsonOperationResult `yaml:"create" json:"create"`
 	UpdateResults *JsonOperationResult `yaml:"update" json:"update"`
 	DeleteResults *JsonOperationResult `yaml:"delete" json:"delete"`
+	Summary       *executor.Summary    `yaml:"summary" json:"summary"`
 }
 
 type JsonOperationResult struct {
-	Responses map[string]string `yaml:"responses" json:"responses" mapstructure:"responses"`
-	Errors    map[string]string `yaml:"errors" json:"errors" mapstructure:"errors"`
+	Responses  map[string]string  `yaml:"responses" json:"responses" mapstructure:"responses"`
+	Statuses   map[string]string  `yaml:"statuses" json:"statuses" mapstructure:"statuses"`
+	Unchanged  map[string]string  `yaml:"unchanged" json:"unchanged" mapstructure:"unchanged"`
+	Errors     map[string]string  `yaml:"errors" json:"errors" mapstructure:"errors"`
+	StackNames map[string]string  `yaml:"stackNames" json:"stackNames" mapstructure:"stackNames"`
+	Durations  map[string]float64 `yaml:"durations" json:"durations" mapstructure:"durations"`
 }
 
 type JsonFormat struct {
-	logger *logging.Logger
+	writer io.Writer
 	result *executor.ExecutionResult
 	Formatter
 }
 
 func NewJsonFormat(
-	logger *logging.Logger,
+	writer io.Writer,
 	result *executor.ExecutionResult) Formatter {
 	return &JsonFormat{
-		logger: logger,
+		writer: writer,
 		result: result}
 }
 
-func (formatter *JsonFormat) PrintResult() {
-
-	// formatter.result.CreateResults = nil
-	///formatter.result.UpdateResults = nil
-	//formatter.result.DeleteResults = nil
-
-	createJsonResults := &JsonOperationResult{
-		Responses: formatter.result.CreateResults.Responses,
-		Errors:    make(map[string]string, len(formatter.result.CreateResults.Errors)),
-	}
-	for k, err := range formatter.result.CreateResults.Errors {
-		createJsonResults.Errors[k] = err.Error()
+func (formatter *JsonFormat) PrintResult() error {
+	data, err := json.Marshal(NewJsonExecutionResult(formatter.result))
+	if err != nil {
+		return err
 	}
+	_, err = fmt.Fprintln(formatter.writer, string(data))
+	return err
+}
 
-	updateJsonResults := &JsonOperationResult{
-		Responses: formatter.result.UpdateResults.Responses,
-		Errors:    make(map[string]string, len(formatter.result.UpdateResults.Errors)),
-	}
-	for k, err := range formatter.result.UpdateResults.Errors {
-		updateJsonResults.Errors[k] = err.Error()
-	}
+// Converts an execution result to a result that can be marshalled,
+// replacing errors with their messages and durations with seconds.
+func NewJsonExecutionResult(result *executor.ExecutionResult) *JsonExecutionResult {
+	return &JsonExecutionResult{
+		ServiceName:   result.ServiceName,
+		HasErrors:     result.HasErrors,
+		CreateResults: newJsonOperationResult(result.CreateResults),
+		UpdateResults: newJsonOperationResult(result.UpdateResults),
+		DeleteResults: newJsonOperationResult(result.DeleteResults),
+		Summary:       result.Summary}
+}
 
-	deleteJsonResults := &JsonOperationResult{
-		Responses: formatter.result.DeleteResults.Responses,
-		Errors:    make(map[string]string, len(formatter.result.DeleteResults.Errors)),
+func newJsonOperationResult(result *executor.OperationResult) *JsonOperationResult {
+	jsonResult := &JsonOperationResult{
+		Responses:  result.Responses,
+		Statuses:   result.Statuses,
+		Unchanged:  result.Unchanged,
+		StackNames: result.StackNames,
+		Durations:  make(map[string]float64, len(result.Durations)),
+		Errors:     make(map[string]string, len(result.Errors))}
+	for k, duration := range result.Durations {
+		jsonResult.Durations[k] = duration.Seconds()
 	}
-	for k, err := range formatter.result.DeleteResults.Errors {
-		deleteJsonResults.Errors[k] = err.Error()
+	for k, err := range result.Errors {
+		jsonResult.Errors[k] = err.Error()
 	}
+	return jsonResult
+}
 
-	jsonExecutionResult := &JsonExecutionResult{
-		ServiceName:   formatter.result.ServiceName,
-		HasErrors:     formatter.result.HasErrors,
-		CreateResults: createJsonResults,
-		UpdateResults: updateJsonResults,
-		DeleteResults: deleteJsonResults}
+type JsonChangesFormat struct {
+	writer  io.Writer
+	changes *executor.StackChanges
+	ChangesFormatter
+}
+
+func NewJsonChangesFormat(
+	writer io.Writer,
+	changes *executor.StackChanges) ChangesFormatter {
+	return &JsonChangesFormat{
+		writer:  writer,
+		changes: changes}
+}
 
-	data, err := json.Marshal(jsonExecutionResult)
+func (formatter *JsonChangesFormat) PrintChanges() error {
+	data, err := json.Marshal(formatter.changes)
 	if err != nil {
-		formatter.logger.Fatal(err)
+		return err
 	}
-	formatter.logger.Info(string(data))
+	_, err = fmt.Fprintln(formatter.writer, string(data))
+	return err
 }
@@ -0,0 +1,133 @@
+package execution
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	"github.com/jeremyhahn/gitformation/internal/git"
+)
+
+type TableFormat struct {
+	writer io.Writer
+	result *executor.ExecutionResult
+	Formatter
+}
+
+func NewTableFormat(
+	writer io.Writer,
+	result *executor.ExecutionResult) Formatter {
+	return &TableFormat{
+		writer: writer,
+		result: result}
+}
+
+func (formatter *TableFormat) PrintResult() error {
+
+	w := tabwriter.NewWriter(formatter.writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSTACK\tACTION\tSTATUS\tDURATION\tSTACK ID")
+
+	actionResults := []struct {
+		action string
+		result *executor.OperationResult
+	}{
+		{git.Insert.String(), formatter.result.CreateResults},
+		{git.Update.String(), formatter.result.UpdateResults},
+		{git.Delete.String(), formatter.result.DeleteResults},
+	}
+	for _, actionResult := range actionResults {
+		result := actionResult.result
+		for _, file := range sortedKeys(result.StackNames) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				file,
+				result.StackNames[file],
+				actionResult.action,
+				operationStatus(result, file),
+				result.Durations[file],
+				result.Responses[file])
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, actionResult := range actionResults {
+		errors := actionResult.result.Errors
+		for _, file := range sortedKeys(errors) {
+			fmt.Fprintf(formatter.writer, "%s: %s\n", file, errors[file])
+		}
+	}
+
+	if summary := formatter.result.Summary; summary != nil {
+		fmt.Fprintf(formatter.writer, "%s: %d total, %d succeeded, %d unchanged, %d failed, %d skipped\n",
+			summary.Outcome, summary.Total, summary.Succeeded, summary.Unchanged, summary.Failed, summary.Skipped)
+	}
+	return nil
+}
+
+// Returns the status of the operation on a file, including
+// operations that failed before reporting a stack status.
+func operationStatus(result *executor.OperationResult, file string) string {
+	if _, ok := result.Unchanged[file]; ok {
+		return executor.StatusUnchanged
+	}
+	if status, ok := result.Statuses[file]; ok {
+		return status
+	}
+	if _, ok := result.Errors[file]; ok {
+		return executor.StatusFailed
+	}
+	return executor.StatusSkipped
+}
+
+type TableChangesFormat struct {
+	writer  io.Writer
+	changes *executor.StackChanges
+	ChangesFormatter
+}
+
+func NewTableChangesFormat(
+	writer io.Writer,
+	changes *executor.StackChanges) ChangesFormatter {
+	return &TableChangesFormat{
+		writer:  writer,
+		changes: changes}
+}
+
+func (formatter *TableChangesFormat) PrintChanges() error {
+
+	fmt.Fprintf(formatter.writer, "change set %s for stack %s (%s)\n",
+		formatter.changes.ChangeSetName, formatter.changes.StackName, formatter.changes.FilePath)
+
+	w := tabwriter.NewWriter(formatter.writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tLOGICAL ID\tTYPE\tREPLACEMENT\tSCOPE\tWARNING")
+	for _, change := range formatter.changes.Changes {
+		warning := ""
+		if change.ReplacesStatefulResource() {
+			warning = "stateful resource will be " + replacementVerb(change)
+		} else if change.Replacement == "True" {
+			warning = "will be replaced"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			change.Action,
+			change.LogicalId,
+			change.ResourceType,
+			change.Replacement,
+			strings.Join(change.Scope, ","),
+			warning)
+	}
+	return w.Flush()
+}
+
+// Returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,74 @@
+package execution
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableFormat(t *testing.T) {
+
+	result := &executor.ExecutionResult{
+		ServiceName:   "cloudformation",
+		CreateResults: executor.NewOperationResult(),
+		UpdateResults: executor.NewOperationResult(),
+		DeleteResults: executor.NewOperationResult()}
+
+	result.CreateResults.StackNames["vpc.template"] = "vpc"
+	result.CreateResults.Responses["vpc.template"] = "arn:vpc"
+	result.CreateResults.Statuses["vpc.template"] = "CREATE_COMPLETE"
+	result.CreateResults.Durations["vpc.template"] = 90 * time.Second
+
+	result.UpdateResults.StackNames["subnet.template"] = "subnet"
+	result.UpdateResults.Unchanged["subnet.template"] = "subnet"
+	result.UpdateResults.Durations["subnet.template"] = 2 * time.Second
+
+	result.DeleteResults.StackNames["ec2.template"] = "ec2"
+	result.DeleteResults.Errors["ec2.template"] = errors.New("access denied")
+	result.DeleteResults.Durations["ec2.template"] = time.Second
+
+	var buf bytes.Buffer
+	assert.NoError(t, NewTableFormat(&buf, result).PrintResult())
+	assert.Equal(t, ""+
+		"FILE             STACK   ACTION  STATUS           DURATION  STACK ID\n"+
+		"vpc.template     vpc     create  CREATE_COMPLETE  1m30s     arn:vpc\n"+
+		"subnet.template  subnet  update  UNCHANGED        2s        \n"+
+		"ec2.template     ec2     delete  FAILED           1s        \n"+
+		"ec2.template: access denied\n", buf.String())
+}
+
+// Returns changes that replace, conditionally replace and remove
+// stateful resources, and replace a stateless one
+func newTestChanges() *executor.StackChanges {
+	return &executor.StackChanges{
+		FilePath:      "templates/db.template",
+		StackName:     "db",
+		ChangeSetName: "gitformation-1",
+		Changes: []*executor.ResourceChange{
+			{Action: "Modify", LogicalId: "Database", ResourceType: "AWS::RDS::DBInstance",
+				Replacement: "True", Scope: []string{"Properties"}, Stateful: true},
+			{Action: "Modify", LogicalId: "Bucket", ResourceType: "AWS::S3::Bucket",
+				Replacement: "Conditional", Scope: []string{"Properties"}, Stateful: true},
+			{Action: "Remove", LogicalId: "Table", ResourceType: "AWS::DynamoDB::Table", Stateful: true},
+			{Action: "Modify", LogicalId: "Function", ResourceType: "AWS::Lambda::Function",
+				Replacement: "True", Scope: []string{"Properties", "Tags"}},
+			{Action: "Modify", LogicalId: "Queue", ResourceType: "AWS::SQS::Queue",
+				Replacement: "False", Scope: []string{"Tags"}, Stateful: true}}}
+}
+
+func TestTableChangesFormat(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, NewTableChangesFormat(&buf, newTestChanges()).PrintChanges())
+	assert.Equal(t, ""+
+		"change set gitformation-1 for stack db (templates/db.template)\n"+
+		"ACTION  LOGICAL ID  TYPE                   REPLACEMENT  SCOPE            WARNING\n"+
+		"Modify  Database    AWS::RDS::DBInstance   True         Properties       stateful resource will be replaced\n"+
+		"Modify  Bucket      AWS::S3::Bucket        Conditional  Properties       stateful resource will be conditionally replaced\n"+
+		"Remove  Table       AWS::DynamoDB::Table                                 stateful resource will be deleted\n"+
+		"Modify  Function    AWS::Lambda::Function  True         Properties,Tags  will be replaced\n"+
+		"Modify  Queue       AWS::SQS::Queue        False        Tags             \n", buf.String())
+}
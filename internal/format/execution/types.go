@@ -1,5 +1,9 @@
 package execution
 
 type Formatter interface {
-	PrintResult()
+	PrintResult() error
+}
+
+type ChangesFormatter interface {
+	PrintChanges() error
 }
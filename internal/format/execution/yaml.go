@@ -0,0 +1,54 @@
+package execution
+
+import (
+	"io"
+
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	"gopkg.in/yaml.v3"
+)
+
+type YamlFormat struct {
+	writer io.Writer
+	result *executor.ExecutionResult
+	Formatter
+}
+
+func NewYamlFormat(
+	writer io.Writer,
+	result *executor.ExecutionResult) Formatter {
+	return &YamlFormat{
+		writer: writer,
+		result: result}
+}
+
+func (formatter *YamlFormat) PrintResult() error {
+	data, err := yaml.Marshal(NewJsonExecutionResult(formatter.result))
+	if err != nil {
+		return err
+	}
+	_, err = formatter.writer.Write(data)
+	return err
+}
+
+type YamlChangesFormat struct {
+	writer  io.Writer
+	changes *executor.StackChanges
+	ChangesFormatter
+}
+
+func NewYamlChangesFormat(
+	writer io.Writer,
+	changes *executor.StackChanges) ChangesFormatter {
+	return &YamlChangesFormat{
+		writer:  writer,
+		changes: changes}
+}
+
+func (formatter *YamlChangesFormat) PrintChanges() error {
+	data, err := yaml.Marshal(formatter.changes)
+	if err != nil {
+		return err
+	}
+	_, err = formatter.writer.Write(data)
+	return err
+}
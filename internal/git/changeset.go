@@ -1,18 +1,40 @@
 package git
 
 type ChangeSet struct {
-	Created []string `yaml:"created" json:"created"`
-	Updated []string `yaml:"updated" json:"updated"`
-	Deleted []string `yaml:"deleted" json:"deleted"`
+	Created []string  `yaml:"created" json:"created"`
+	Updated []string  `yaml:"updated" json:"updated"`
+	Deleted []string  `yaml:"deleted" json:"deleted"`
+	Renamed []*Rename `yaml:"renamed" json:"renamed"`
+	// Files updated because a related file changed, such as a parameters
+	// file, mapped to the file that changed
+	Triggered map[string]string `yaml:"triggered,omitempty" json:"triggered,omitempty"`
+	// The submodules whose commit changed
+	Submodules []*SubmoduleChange `yaml:"submodules,omitempty" json:"submodules,omitempty"`
+	// The deployment directives in the commit message
+	Directives *Directives `yaml:"directives,omitempty" json:"directives,omitempty"`
+	// The changed files that did not match the filters
+	Filtered *ChangeSet `yaml:"-" json:"-"`
 }
 
-func NewChangeSet(created []string, updated []string, deleted []string) *ChangeSet {
+// A file that was moved or renamed, with or without changes
+type Rename struct {
+	From string `yaml:"from" json:"from"`
+	To   string `yaml:"to" json:"to"`
+}
+
+func NewChangeSet(created []string, updated []string, deleted []string, renamed []*Rename) *ChangeSet {
 	return &ChangeSet{
 		Created: created,
 		Updated: updated,
-		Deleted: deleted}
+		Deleted: deleted,
+		Renamed: renamed}
+}
+
+// Returns a new ChangeSet without any changes
+func NewEmptyChangeSet() *ChangeSet {
+	return NewChangeSet(make([]string, 0), make([]string, 0), make([]string, 0), make([]*Rename, 0))
 }
 
 func (changeSet *ChangeSet) Len() int {
-	return len(changeSet.Created) + len(changeSet.Updated) + len(changeSet.Updated)
+	return len(changeSet.Created) + len(changeSet.Updated) + len(changeSet.Deleted) + len(changeSet.Renamed)
 }
@@ -1,6 +1,6 @@
 package git
 
-import "log"
+import "fmt"
 
 type ActionType int
 
@@ -19,6 +19,18 @@ func (a ActionType) String() string {
 	case Delete:
 		return "delete"
 	}
-	log.Fatalf("invalid git action type: %d", a)
-	return ""
+	return fmt.Sprintf("unknown(%d)", int(a))
+}
+
+// Parses an action type from its string representation
+func ParseActionType(action string) (ActionType, error) {
+	switch action {
+	case "create":
+		return Insert, nil
+	case "update":
+		return Update, nil
+	case "delete":
+		return Delete, nil
+	}
+	return 0, fmt.Errorf("invalid git action type: %s", action)
 }
@@ -0,0 +1,116 @@
+package git
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Commit message directives that control a deployment
+const (
+	SkipDeployDirective    = "[skip deploy]"
+	DeployOnlyTrailer      = "Deploy-Only"
+	ForceRedeployTrailer   = "Force-Redeploy"
+	DeployEnvTrailer       = "Deploy-Env"
+	directiveListSeparator = ","
+)
+
+// Deployment directives parsed from a commit message, letting a commit
+// skip, force or scope its deployment without changing CI configuration.
+type Directives struct {
+	// The commit message contains [skip deploy]
+	Skip bool `yaml:"skip,omitempty" json:"skip,omitempty"`
+	// Only deploy these stacks (Deploy-Only: vpc,iam)
+	DeployOnly []string `yaml:"deployOnly,omitempty" json:"deployOnly,omitempty"`
+	// Update these stacks even if their templates did not change (Force-Redeploy: app)
+	ForceRedeploy []string `yaml:"forceRedeploy,omitempty" json:"forceRedeploy,omitempty"`
+	// Only deploy to these environments (Deploy-Env: preprod)
+	DeployEnv []string `yaml:"deployEnv,omitempty" json:"deployEnv,omitempty"`
+}
+
+// Parses the deployment directives in a commit message. [skip deploy] may
+// appear anywhere in the message, while Deploy-Only, Force-Redeploy and
+// Deploy-Env are read from the trailers in the last paragraph. Trailer keys
+// are case-insensitive, values are comma separated lists, and repeated
+// trailers are combined.
+func ParseDirectives(message string) *Directives {
+
+	directives := &Directives{
+		Skip: strings.Contains(strings.ToLower(message), SkipDeployDirective)}
+
+	paragraphs := strings.Split(strings.TrimSpace(strings.ReplaceAll(message, "\r\n", "\n")), "\n\n")
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		switch {
+		case strings.EqualFold(key, DeployOnlyTrailer):
+			directives.DeployOnly = append(directives.DeployOnly, parseDirectiveList(value)...)
+		case strings.EqualFold(key, ForceRedeployTrailer):
+			directives.ForceRedeploy = append(directives.ForceRedeploy, parseDirectiveList(value)...)
+		case strings.EqualFold(key, DeployEnvTrailer):
+			directives.DeployEnv = append(directives.DeployEnv, parseDirectiveList(value)...)
+		}
+	}
+	return directives
+}
+
+// Splits a comma separated trailer value, dropping empty values
+func parseDirectiveList(value string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(value, directiveListSeparator) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Returns true if the commit message does not contain any directives
+func (directives *Directives) IsEmpty() bool {
+	return directives == nil ||
+		(!directives.Skip &&
+			len(directives.DeployOnly) == 0 &&
+			len(directives.ForceRedeploy) == 0 &&
+			len(directives.DeployEnv) == 0)
+}
+
+// Returns true if the directives allow deploying to an environment
+func (directives *Directives) DeploysTo(env string) bool {
+	if directives == nil {
+		return true
+	}
+	return !directives.Skip && (len(directives.DeployEnv) == 0 || slices.Contains(directives.DeployEnv, env))
+}
+
+// Returns true if the deployment is scoped to a subset of the stacks
+func (directives *Directives) IsScoped() bool {
+	return directives != nil && len(directives.DeployOnly) > 0
+}
+
+// Returns true if the directives allow deploying a stack
+func (directives *Directives) DeploysStack(stackName string) bool {
+	return !directives.IsScoped() || slices.Contains(directives.DeployOnly, stackName)
+}
+
+func (directives *Directives) String() string {
+	parts := make([]string, 0, 4)
+	if directives.Skip {
+		parts = append(parts, SkipDeployDirective)
+	}
+	for _, trailer := range []struct {
+		key    string
+		values []string
+	}{
+		{DeployOnlyTrailer, directives.DeployOnly},
+		{ForceRedeployTrailer, directives.ForceRedeploy},
+		{DeployEnvTrailer, directives.DeployEnv},
+	} {
+		if len(trailer.values) > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %s", trailer.key, strings.Join(trailer.values, directiveListSeparator)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,59 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDirectives(t *testing.T) {
+	directives := ParseDirectives("Update the vpc [Skip Deploy]\n\nDeploy-Only: vpc")
+	assert.True(t, directives.Skip)
+	assert.Equal(t, []string{"vpc"}, directives.DeployOnly)
+
+	directives = ParseDirectives(`Update the network stacks
+
+Deploy-Only: vpc, iam
+deploy-only: subnets
+Force-Redeploy: app-stack
+Deploy-Env: preprod,prod
+Signed-off-by: Dev <dev@example.com>
+`)
+	assert.False(t, directives.Skip)
+	assert.Equal(t, []string{"vpc", "iam", "subnets"}, directives.DeployOnly)
+	assert.Equal(t, []string{"app-stack"}, directives.ForceRedeploy)
+	assert.Equal(t, []string{"preprod", "prod"}, directives.DeployEnv)
+	assert.Equal(t, "Deploy-Only: vpc,iam,subnets, Force-Redeploy: app-stack, Deploy-Env: preprod,prod", directives.String())
+
+	// Trailers must be in the last paragraph
+	directives = ParseDirectives("Update\n\nDeploy-Only: vpc\n\nMore details")
+	assert.True(t, directives.IsEmpty())
+}
+
+func TestDirectivesScope(t *testing.T) {
+	var none *Directives
+	assert.True(t, none.IsEmpty())
+	assert.True(t, none.DeploysTo("prod"))
+	assert.True(t, none.DeploysStack("vpc"))
+
+	directives := &Directives{DeployOnly: []string{"vpc"}, DeployEnv: []string{"preprod"}}
+	assert.True(t, directives.DeploysTo("preprod"))
+	assert.False(t, directives.DeploysTo("prod"))
+	assert.True(t, directives.DeploysStack("vpc"))
+	assert.False(t, directives.DeploysStack("web"))
+
+	directives = &Directives{Skip: true}
+	assert.False(t, directives.DeploysTo("preprod"))
+}
+
+func TestDiffParsesDirectives(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	r.commit("initial")
+	r.write("templates/vpc.template", template("Vpc")+"Outputs: {}\n")
+	r.commit("Update the vpc\n\nForce-Redeploy: web\n")
+
+	changeSet, err := r.parser(&ParserOptions{}).Diff("", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web"}, changeSet.Directives.ForceRedeploy)
+}
@@ -0,0 +1,21 @@
+package git
+
+import "errors"
+
+var (
+	ErrRepositoryOpen         = errors.New("unable to open git repository")
+	ErrRepositoryClone        = errors.New("unable to clone git repository")
+	ErrRemoteAuth             = errors.New("unable to configure git authentication")
+	ErrInvalidFilter          = errors.New("invalid filter")
+	ErrInvalidRenameThreshold = errors.New("rename threshold must be between 0 and 100")
+	ErrInvalidMergeStrategy   = errors.New("invalid merge strategy")
+	ErrRevision               = errors.New("unable to resolve git revision")
+	ErrWorktree               = errors.New("unable to read working tree")
+	ErrDiff                   = errors.New("unable to diff git commits")
+	ErrSubmodule              = errors.New("unable to read git submodule")
+	ErrSigningKeys            = errors.New("unable to load trusted signing keys")
+	ErrSignature              = errors.New("commit signature verification failed")
+	ErrGuardRules             = errors.New("unable to load guard rules")
+	ErrGuardViolation         = errors.New("deployment blocked by guard rules")
+	ErrDeployMarker           = errors.New("unable to access deployment marker")
+)
@@ -0,0 +1,169 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// The file at the root of the repository listing gitignore style
+// patterns for files that are never treated as stacks
+const IgnoreFile = ".gitformationignore"
+
+// Decides which changed files are processed, using the --filter regular
+// expression, --include and --exclude globs and the ignore file.
+type pathFilter struct {
+	regexp  *regexp.Regexp
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	ignore  gitignore.Matcher
+}
+
+// Returns true if a file should be processed. A file is processed if it
+// matches the --filter, matches at least one --include glob (when any are
+// set), and does not match any --exclude glob or ignore file pattern.
+func (filter *pathFilter) Match(filePath string) bool {
+	if filePath == IgnoreFile {
+		return false
+	}
+	if filter.regexp != nil && !filter.regexp.MatchString(filePath) {
+		return false
+	}
+	if len(filter.include) > 0 && !matchAny(filter.include, filePath) {
+		return false
+	}
+	if matchAny(filter.exclude, filePath) {
+		return false
+	}
+	if filter.ignore != nil && filter.ignore.Match(strings.Split(filePath, "/"), false) {
+		return false
+	}
+	return true
+}
+
+// Returns true if any of the patterns match the file path
+func matchAny(patterns []*regexp.Regexp, filePath string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compiles a list of glob patterns
+func compileGlobs(patterns []string) ([]*regexp.Regexp, error) {
+	globs := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		glob, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		globs[i] = glob
+	}
+	return globs, nil
+}
+
+// Compiles a glob pattern into a regular expression that must match the
+// entire path relative to the repository root. A * or ? matches within a
+// single path segment, and ** matches any number of segments
+// (ex: templates/**/*.yaml).
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// **/ matches zero or more directories
+					i++
+					expr.WriteString("(?:.*/)?")
+				} else {
+					expr.WriteString(".*")
+				}
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: %s: unterminated character class", ErrInvalidFilter, pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	glob, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidFilter, pattern, err)
+	}
+	return glob, nil
+}
+
+// Parses gitignore style patterns, skipping blank lines and comments
+func parseIgnorePatterns(reader io.Reader) (gitignore.Matcher, error) {
+	patterns := make([]gitignore.Pattern, 0)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidFilter, IgnoreFile, err)
+	}
+	return gitignore.NewMatcher(patterns), nil
+}
+
+// Returns the ignore file patterns in a tree, or nil if the tree
+// does not have an ignore file.
+func treeIgnorePatterns(tree *object.Tree) (gitignore.Matcher, error) {
+	file, err := tree.File(IgnoreFile)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidFilter, IgnoreFile, err)
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidFilter, IgnoreFile, err)
+	}
+	return parseIgnorePatterns(bytes.NewBufferString(contents))
+}
+
+// Returns the ignore file patterns in a working tree, or nil if the
+// working tree does not have an ignore file.
+func worktreeIgnorePatterns(fs billy.Filesystem) (gitignore.Matcher, error) {
+	file, err := fs.Open(IgnoreFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidFilter, IgnoreFile, err)
+	}
+	defer file.Close()
+	return parseIgnorePatterns(file)
+}
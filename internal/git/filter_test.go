@@ -0,0 +1,97 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		glob    string
+		path    string
+		matches bool
+	}{
+		{"templates/*", "templates/vpc.template", true},
+		{"templates/*", "templates/network/vpc.template", false},
+		{"templates/*", "other/templates/vpc.template", false},
+		{"templates/**", "templates/network/vpc.template", true},
+		{"**/*.template", "vpc.template", true},
+		{"**/*.template", "templates/network/vpc.template", true},
+		{"**/*.template", "templates/vpc.template.bak", false},
+		{"templates/**/vpc.template", "templates/vpc.template", true},
+		{"templates/**/vpc.template", "templates/a/b/vpc.template", true},
+		{"templates/?pc.template", "templates/vpc.template", true},
+		{"templates/[!v]pc.template", "templates/vpc.template", false},
+		{"templates/[a-z]pc.template", "templates/vpc.template", true},
+		{"*.md", "templates/README.md", false},
+		{"templates/vpc.template", "templates/vpc_template", false},
+	}
+	for _, test := range tests {
+		glob, err := compileGlob(test.glob)
+		assert.NoError(t, err, test.glob)
+		assert.Equal(t, test.matches, glob.MatchString(test.path), "%s %s", test.glob, test.path)
+	}
+
+	_, err := compileGlob("templates/[vpc")
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
+
+func TestDiffIncludeExclude(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("README.md", "readme")
+	r.commit("initial")
+
+	r.write("templates/vpc.template", template("Vpc"))
+	r.write("templates/network/subnet.template", template("Subnet"))
+	r.write("templates/README.md", "readme")
+	r.write("templates/legacy/old.template", template("Old"))
+	r.write("scripts/deploy.sh", "#!/bin/sh")
+	r.commit("add templates")
+
+	parser := r.parser(&ParserOptions{
+		Include: []string{"templates/**/*.template"},
+		Exclude: []string{"templates/legacy/**"}})
+	changeSet, err := parser.Diff("", "HEAD")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"templates/vpc.template", "templates/network/subnet.template"}, changeSet.Created)
+	assert.ElementsMatch(t, []string{"templates/README.md", "templates/legacy/old.template", "scripts/deploy.sh"},
+		changeSet.Filtered.Created)
+
+	_, err = newGitParser(parser.logger, r.repo, &ParserOptions{Exclude: []string{"[a"}})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
+
+func TestDiffIgnoreFile(t *testing.T) {
+	r := newTestRepo(t)
+	r.write(IgnoreFile, "# not stacks\n*.md\nparameters/\n!templates/keep.md\n")
+	r.write("templates/vpc.template", template("Vpc"))
+	r.write("templates/README.md", "readme")
+	r.write("templates/keep.md", "keep")
+	r.write("parameters/vpc.json", "[]")
+	r.commit("initial")
+
+	parser := r.parser(&ParserOptions{})
+
+	// The initial commit is filtered using its own ignore file
+	changeSet, err := parser.Diff("", "HEAD")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"templates/vpc.template", "templates/keep.md"}, changeSet.Created)
+
+	r.write("templates/README.md", "changed")
+	r.write("parameters/vpc.json", "[{}]")
+	r.write("templates/vpc.template", template("Vpc")+"Outputs: {}\n")
+	r.commit("update")
+
+	changeSet, err = parser.Diff("", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/vpc.template"}, changeSet.Updated)
+
+	// Uncommitted changes use the ignore file in the working tree
+	r.edit(IgnoreFile, "*.template\n")
+	r.edit("templates/vpc.template", template("Vpc"))
+	r.edit("templates/README.md", "changed again")
+	changeSet, err = parser.DiffWorktree(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/README.md"}, changeSet.Updated)
+}
@@ -0,0 +1,234 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"gopkg.in/yaml.v3"
+)
+
+// The rules the commits deployed to an environment must satisfy. Each
+// list is a set of globs, and an empty list does not restrict anything.
+type GuardRule struct {
+	// The branches of the Remote that must contain the deployed commit
+	Branches []string `yaml:"branches" json:"branches"`
+	// The remote whose tracking branches are matched against
+	// Branches (default: origin). Local branches are never trusted.
+	Remote string `yaml:"remote" json:"remote"`
+	// The tags that may point at the deployed commit, instead of a branch
+	Tags []string `yaml:"tags" json:"tags"`
+	// The author emails allowed in the deployed commits
+	Authors []string `yaml:"authors" json:"authors"`
+	// The committer emails allowed in the deployed commits
+	Committers []string `yaml:"committers" json:"committers"`
+}
+
+// The remote whose branches are trusted when a rule does not set one
+const DefaultGuardRemote = "origin"
+
+// The guard rules for each environment. Environments
+// without rules may be deployed from any commit.
+type GuardRules map[string]*GuardRule
+
+// Parses a --guard-rules file
+func LoadGuardRules(file string) (GuardRules, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrGuardRules, err)
+	}
+	rules := make(GuardRules)
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrGuardRules, file, err)
+	}
+	for env, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		for _, globs := range [][]string{rule.Branches, rule.Tags, rule.Authors, rule.Committers} {
+			if _, err := compileGlobs(globs); err != nil {
+				return nil, fmt.Errorf("%w: %s: %s: %w", ErrGuardRules, file, env, err)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// Checks the guard rules for an environment before anything is diffed
+// or deployed. The to commit must be contained in an allowed branch of the
+// rule's remote or be pointed at by an allowed tag on that remote, and the
+// author and committer of each deployed commit must be allowed. If from is
+// empty only the to commit's author and committer are checked, otherwise
+// those of every commit reachable from to but not from from.
+func (parser *GitParser) CheckGuardRules(env, from, to string, rules GuardRules) error {
+	rule, ok := rules[env]
+	if !ok || rule == nil {
+		return nil
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+	toCommit, err := parser.commit(to)
+	if err != nil {
+		return err
+	}
+
+	if len(rule.Branches) > 0 || len(rule.Tags) > 0 {
+		ref, err := parser.allowedRef(toCommit, rule)
+		if err != nil {
+			return err
+		}
+		if ref == "" {
+			return fmt.Errorf("%w: %s may only be deployed from %s branches %s or tags %s, but %s (%s) is not on any of them",
+				ErrGuardViolation, env, rule.remote(), globList(rule.Branches), globList(rule.Tags), to, toCommit.Hash)
+		}
+		parser.logger.Infof("Deploying %s from %s", env, ref)
+	}
+
+	if len(rule.Authors) == 0 && len(rule.Committers) == 0 {
+		return nil
+	}
+	// Emails are compared case-insensitively
+	authors, err := compileGlobs(lowerAll(rule.Authors))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrGuardRules, err)
+	}
+	committers, err := compileGlobs(lowerAll(rule.Committers))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrGuardRules, err)
+	}
+	commits, err := parser.commitRange(from, to)
+	if err != nil {
+		return err
+	}
+	for _, commit := range commits {
+		if len(authors) > 0 && !matchAny(authors, strings.ToLower(commit.Author.Email)) {
+			return fmt.Errorf("%w: commit %s author %s is not allowed to deploy to %s",
+				ErrGuardViolation, commit.Hash, commit.Author.Email, env)
+		}
+		if len(committers) > 0 && !matchAny(committers, strings.ToLower(commit.Committer.Email)) {
+			return fmt.Errorf("%w: commit %s committer %s is not allowed to deploy to %s",
+				ErrGuardViolation, commit.Hash, commit.Committer.Email, env)
+		}
+	}
+	return nil
+}
+
+// Returns the name of an allowed remote-tracking branch containing the
+// commit, or of an allowed tag pointing at it, or an empty string if there
+// is none. Local branches and tags can be created or moved by anyone with
+// a checkout, so only the branches fetched from the rule's remote are
+// matched, and tags are looked up on the remote itself.
+func (parser *GitParser) allowedRef(commit *object.Commit, rule *GuardRule) (string, error) {
+	branches, err := compileGlobs(rule.Branches)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrGuardRules, err)
+	}
+	tags, err := compileGlobs(rule.Tags)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrGuardRules, err)
+	}
+	refs, err := parser.repo.References()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrRevision, err)
+	}
+	var allowed string
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || !ref.Name().IsRemote() {
+			return nil
+		}
+		branch := remoteBranch(ref.Name(), rule.remote())
+		if branch == "" || !matchAny(branches, branch) || !parser.contains(ref.Hash(), commit) {
+			return nil
+		}
+		allowed = ref.Name().Short()
+		return storer.ErrStop
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrRevision, err)
+	}
+	if allowed != "" || len(tags) == 0 {
+		return allowed, nil
+	}
+	return parser.remoteTag(commit, rule.remote(), tags)
+}
+
+// Returns the name of a tag on the remote that matches the globs and points
+// at the commit, or an empty string if there is none. Annotated tags match
+// the commit they point at.
+func (parser *GitParser) remoteTag(commit *object.Commit, remoteName string, tags []*regexp.Regexp) (string, error) {
+	remote, err := parser.repo.Remote(remoteName)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrRevision, remoteName, err)
+	}
+	refs, err := remote.List(&git.ListOptions{Auth: parser.auth, PeelingOption: git.AppendPeeled})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: unable to list the tags of %s: %w", ErrRevision, remoteName, err)
+	}
+	for _, ref := range refs {
+		name := plumbing.ReferenceName(strings.TrimSuffix(ref.Name().String(), "^{}"))
+		if name.IsTag() && matchAny(tags, name.Short()) && ref.Hash() == commit.Hash {
+			return remoteName + "/" + name.Short(), nil
+		}
+	}
+	return "", nil
+}
+
+// Returns true if the branch tip is, or descends from, the commit
+func (parser *GitParser) contains(tip plumbing.Hash, commit *object.Commit) bool {
+	if tip == commit.Hash {
+		return true
+	}
+	tipCommit, err := parser.repo.CommitObject(tip)
+	if err != nil {
+		return false
+	}
+	ancestor, err := commit.IsAncestor(tipCommit)
+	return err == nil && ancestor
+}
+
+// Returns the remote whose branches are trusted
+func (rule *GuardRule) remote() string {
+	if rule.Remote == "" {
+		return DefaultGuardRemote
+	}
+	return rule.Remote
+}
+
+// Returns the branch name of a reference tracking the remote, or an empty
+// string for other references (ex: refs/remotes/origin/release/1.0 is
+// release/1.0 for the origin remote)
+func remoteBranch(name plumbing.ReferenceName, remote string) string {
+	branch, ok := strings.CutPrefix(name.String(), "refs/remotes/"+remote+"/")
+	if !ok {
+		return ""
+	}
+	return branch
+}
+
+// Returns the strings in lower case
+func lowerAll(values []string) []string {
+	lower := make([]string, len(values))
+	for i, value := range values {
+		lower[i] = strings.ToLower(value)
+	}
+	return lower
+}
+
+// Formats a list of globs for an error message
+func globList(globs []string) string {
+	if len(globs) == 0 {
+		return "(none)"
+	}
+	return strings.Join(globs, ",")
+}
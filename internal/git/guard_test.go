@@ -0,0 +1,156 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+// Points a branch or tag reference at a commit
+func (r *testRepo) ref(name, commit string) {
+	assert.NoError(r.t, r.repo.Storer.SetReference(
+		plumbing.NewHashReference(plumbing.ReferenceName(name), plumbing.NewHash(commit))))
+}
+
+// Creates a commit of the staged changes by the author
+func (r *testRepo) commitBy(message, email string) string {
+	hash, err := r.worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: email, When: time.Now()}})
+	assert.NoError(r.t, err)
+	return hash.String()
+}
+
+// Adds a new bare repository as the origin remote
+func (r *testRepo) origin() {
+	remote := r.t.TempDir()
+	_, err := git.PlainInit(remote, true)
+	assert.NoError(r.t, err)
+	_, err = r.repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remote}})
+	assert.NoError(r.t, err)
+}
+
+// Pushes a tag to the origin remote
+func (r *testRepo) pushTag(name string) {
+	assert.NoError(r.t, r.repo.Push(&git.PushOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{config.RefSpec("+refs/tags/" + name + ":refs/tags/" + name)}}))
+}
+
+func TestCheckGuardRulesRefs(t *testing.T) {
+	r := newTestRepo(t)
+	r.origin()
+	r.write("templates/vpc.template", template("Vpc"))
+	first := r.commit("initial")
+	r.write("templates/db.template", template("Db"))
+	second := r.commit("add db")
+	r.ref("refs/remotes/origin/main", second)
+
+	r.write("templates/web.template", template("Web"))
+	feature := r.commit("add web")
+	r.ref("refs/heads/main", feature)
+	r.ref("refs/heads/feature/web", feature)
+	r.ref("refs/remotes/fork/main", feature)
+
+	rules := GuardRules{"prod": &GuardRule{Branches: []string{"main"}, Tags: []string{"v*"}}}
+	parser := r.parser(&ParserOptions{})
+
+	// Environments without rules are not restricted
+	assert.NoError(t, parser.CheckGuardRules("nonprod", "", feature, rules))
+
+	// Commits on the origin main branch are allowed
+	assert.NoError(t, parser.CheckGuardRules("prod", "", second, rules))
+	assert.NoError(t, parser.CheckGuardRules("prod", "", first, rules))
+
+	// Local branches and branches of other remotes are not trusted
+	err := parser.CheckGuardRules("prod", "", feature, rules)
+	assert.ErrorIs(t, err, ErrGuardViolation)
+	assert.Contains(t, err.Error(), "prod may only be deployed from origin branches main or tags v*")
+
+	rules["prod"].Branches = []string{"*"}
+	assert.ErrorIs(t, parser.CheckGuardRules("prod", "", feature, rules), ErrGuardViolation)
+
+	// The trusted remote can be configured
+	rules["prod"].Branches = []string{"main"}
+	rules["prod"].Remote = "fork"
+	assert.NoError(t, parser.CheckGuardRules("prod", "", feature, rules))
+	rules["prod"].Remote = ""
+
+	// Local tags are not trusted
+	r.ref("refs/tags/v1.0.0", feature)
+	assert.ErrorIs(t, parser.CheckGuardRules("prod", "", feature, rules), ErrGuardViolation)
+
+	// A matching tag on the remote allows the commit it points at
+	r.pushTag("v1.0.0")
+	assert.NoError(t, parser.CheckGuardRules("prod", "", feature, rules))
+	r.ref("refs/tags/v1.0.0", second)
+	r.pushTag("v1.0.0")
+	assert.ErrorIs(t, parser.CheckGuardRules("prod", "", feature, rules), ErrGuardViolation)
+
+	// Annotated tags match the commit they point at
+	_, err = r.repo.CreateTag("v1.1.0", plumbing.NewHash(feature), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		Message: "release"})
+	assert.NoError(t, err)
+	r.pushTag("v1.1.0")
+	assert.NoError(t, parser.CheckGuardRules("prod", "", feature, rules))
+}
+
+func TestCheckGuardRulesAuthors(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	first := r.commitBy("initial", "Alice@Example.com")
+	r.write("templates/db.template", template("Db"))
+	r.commitBy("add db", "mallory@evil.example")
+	r.write("templates/web.template", template("Web"))
+	r.commitBy("add web", "bob@example.com")
+
+	rules := GuardRules{"prod": &GuardRule{Authors: []string{"*@example.com"}}}
+	parser := r.parser(&ParserOptions{})
+
+	// Only the deployed commit is checked without a from revision
+	assert.NoError(t, parser.CheckGuardRules("prod", "", "HEAD", rules))
+	assert.NoError(t, parser.CheckGuardRules("prod", "", first, rules))
+
+	// Every commit in the range is checked
+	err := parser.CheckGuardRules("prod", first, "HEAD", rules)
+	assert.ErrorIs(t, err, ErrGuardViolation)
+	assert.Contains(t, err.Error(), "author mallory@evil.example is not allowed")
+
+	rules["prod"] = &GuardRule{Committers: []string{"alice@example.com"}}
+	assert.NoError(t, parser.CheckGuardRules("prod", "", first, rules))
+	assert.ErrorIs(t, parser.CheckGuardRules("prod", "", "HEAD", rules), ErrGuardViolation)
+}
+
+func TestLoadGuardRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "guard-rules.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(`
+prod:
+  branches: [main]
+  remote: upstream
+  tags: ["v*"]
+  authors: ["*@example.com"]
+nonprod:
+`), 0644))
+
+	rules, err := LoadGuardRules(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main"}, rules["prod"].Branches)
+	assert.Equal(t, "upstream", rules["prod"].Remote)
+	assert.Equal(t, []string{"v*"}, rules["prod"].Tags)
+	assert.Equal(t, []string{"*@example.com"}, rules["prod"].Authors)
+	assert.Nil(t, rules["nonprod"])
+
+	assert.NoError(t, os.WriteFile(file, []byte("prod:\n  branches: [\"release/[\"]\n"), 0644))
+	_, err = LoadGuardRules(file)
+	assert.ErrorIs(t, err, ErrGuardRules)
+
+	_, err = LoadGuardRules(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorIs(t, err, ErrGuardRules)
+}
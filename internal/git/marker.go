@@ -0,0 +1,81 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// The prefix of the tags that record the last commit
+// successfully deployed to each environment
+const deployMarkerPrefix = "gitformation/"
+
+// Returns the name of the tag that marks the last
+// successful deployment to an environment
+func DeployMarker(env string) string {
+	return deployMarkerPrefix + env
+}
+
+// Returns the commit last successfully deployed to an environment,
+// or an empty string if the environment has not been deployed.
+func (parser *GitParser) LastDeploy(env string) (string, error) {
+	ref, err := parser.repo.Tag(DeployMarker(env))
+	if errors.Is(err, git.ErrTagNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrDeployMarker, DeployMarker(env), err)
+	}
+	return ref.Hash().String(), nil
+}
+
+// Moves the deployment marker for an environment to a commit
+func (parser *GitParser) MarkDeployed(env, commit string) error {
+	ref := plumbing.NewHashReference(plumbing.NewTagReferenceName(DeployMarker(env)), plumbing.NewHash(commit))
+	if err := parser.repo.Storer.SetReference(ref); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrDeployMarker, DeployMarker(env), err)
+	}
+	parser.logger.Infof("Marked %s as the last deployment to %s (tag %s)", commit, env, DeployMarker(env))
+	return nil
+}
+
+// Fetches the deployment marker for an environment from a remote, with
+// the credentials the repository was cloned with, replacing the local marker. A marker missing from the remote is
+// not an error.
+func (parser *GitParser) FetchDeployMarker(remote, env string) error {
+	err := parser.repo.Fetch(&git.FetchOptions{
+		RemoteName: remote,
+		RefSpecs:   []config.RefSpec{markerRefSpec(env)},
+		Tags:       git.NoTags,
+		Auth:       parser.auth})
+	if err == nil || errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	var noMatch git.NoMatchingRefSpecError
+	if errors.As(err, &noMatch) {
+		return nil
+	}
+	return fmt.Errorf("%w: fetch %s from %s: %w", ErrDeployMarker, DeployMarker(env), remote, err)
+}
+
+// Pushes the deployment marker for an environment to a remote, with
+// the credentials the repository was cloned with, replacing the remote marker.
+func (parser *GitParser) PushDeployMarker(remote, env string) error {
+	err := parser.repo.Push(&git.PushOptions{
+		RemoteName: remote,
+		RefSpecs:   []config.RefSpec{markerRefSpec(env)},
+		Auth:       parser.auth})
+	if err == nil || errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return fmt.Errorf("%w: push %s to %s: %w", ErrDeployMarker, DeployMarker(env), remote, err)
+}
+
+// Returns a forced ref spec that maps the marker tag to itself
+func markerRefSpec(env string) config.RefSpec {
+	name := plumbing.NewTagReferenceName(DeployMarker(env))
+	return config.RefSpec(fmt.Sprintf("+%s:%s", name, name))
+}
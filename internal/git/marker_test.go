@@ -0,0 +1,130 @@
+package git
+
+import (
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployMarker(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	first := r.commit("initial")
+
+	parser := r.parser(&ParserOptions{})
+
+	commit, err := parser.LastDeploy("nonprod")
+	assert.NoError(t, err)
+	assert.Empty(t, commit)
+
+	assert.NoError(t, parser.MarkDeployed("nonprod", first))
+	commit, err = parser.LastDeploy("nonprod")
+	assert.NoError(t, err)
+	assert.Equal(t, first, commit)
+
+	// Markers are moved forward, and kept per environment
+	r.write("templates/db.template", template("Db"))
+	second := r.commit("add db")
+	assert.NoError(t, parser.MarkDeployed("nonprod", second))
+	commit, err = parser.LastDeploy("nonprod")
+	assert.NoError(t, err)
+	assert.Equal(t, second, commit)
+
+	commit, err = parser.LastDeploy("prod")
+	assert.NoError(t, err)
+	assert.Empty(t, commit)
+}
+
+func TestPushAndFetchDeployMarker(t *testing.T) {
+	remote := t.TempDir()
+	_, err := git.PlainInit(remote, true)
+	assert.NoError(t, err)
+
+	newClone := func() *testRepo {
+		r := newTestRepo(t)
+		_, err := r.repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remote}})
+		assert.NoError(t, err)
+		return r
+	}
+
+	r := newClone()
+	r.write("templates/vpc.template", template("Vpc"))
+	commit := r.commit("initial")
+	assert.NoError(t, r.repo.Push(&git.PushOptions{RemoteName: "origin"}))
+
+	parser := r.parser(&ParserOptions{})
+	assert.NoError(t, parser.MarkDeployed("nonprod", commit))
+	assert.NoError(t, parser.PushDeployMarker("origin", "nonprod"))
+
+	other := newClone()
+	otherParser := other.parser(&ParserOptions{})
+
+	// A marker that has not been pushed is not an error
+	assert.NoError(t, otherParser.FetchDeployMarker("origin", "prod"))
+
+	assert.NoError(t, otherParser.FetchDeployMarker("origin", "nonprod"))
+	ref, err := other.repo.Reference(plumbing.NewTagReferenceName(DeployMarker("nonprod")), true)
+	assert.NoError(t, err)
+	assert.Equal(t, commit, ref.Hash().String())
+}
+
+// Serves the bare repository at a file:// URL over smart HTTP with git
+// http-backend, requiring the token as the basic auth password
+func newAuthenticatedRemote(t *testing.T, url, token string) string {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := strings.TrimPrefix(url, "file://")
+	backend := &cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + filepath.Dir(dir),
+			"GIT_HTTP_EXPORT_ALL=1",
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.receivepack",
+			"GIT_CONFIG_VALUE_0=true"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password, ok := r.BasicAuth(); !ok || password != token {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/" + filepath.Base(dir)
+}
+
+func TestDeployMarkerAuthenticatedRemote(t *testing.T) {
+	url := newAuthenticatedRemote(t, newBareRemote(t), "secret")
+	logger := logging.MustGetLogger("test")
+	options := &RemoteOptions{URL: url, Token: "secret", InMemory: true}
+
+	parser, err := NewRemoteRepoParser(logger, options, &ParserOptions{})
+	assert.NoError(t, err)
+	head, err := parser.Head()
+	assert.NoError(t, err)
+
+	// The marker is pushed and fetched with the clone's credentials
+	assert.NoError(t, parser.MarkDeployed("nonprod", head))
+	assert.NoError(t, parser.PushDeployMarker("origin", "nonprod"))
+
+	other, err := NewRemoteRepoParser(logger, options, &ParserOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, other.FetchDeployMarker("origin", "nonprod"))
+	commit, err := other.LastDeploy("nonprod")
+	assert.NoError(t, err)
+	assert.Equal(t, head, commit)
+}
@@ -0,0 +1,158 @@
+package git
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Diffs a merge commit using the --merge-strategy
+func (parser *GitParser) diffMerge(commit *object.Commit) (*ChangeSet, error) {
+
+	parents := make([]*object.Commit, len(commit.ParentHashes))
+	for i := range commit.ParentHashes {
+		parent, err := commit.Parent(i)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s^%d: %w", ErrRevision, commit.Hash, i+1, err)
+		}
+		parents[i] = parent
+	}
+
+	switch parser.options.MergeStrategy {
+
+	case MergeStrategyUnion:
+		parser.logger.Infof("Merge commit %s has %d parents, combining the changes against each parent",
+			commit.Hash, len(parents))
+		changeSets := make([]*ChangeSet, len(parents))
+		for i, parent := range parents {
+			changeSet, err := parser.diffCommits(parent, commit)
+			if err != nil {
+				return nil, err
+			}
+			changeSets[i] = changeSet
+		}
+		return unionChangeSets(changeSets), nil
+
+	case MergeStrategyMergeBase:
+		base, err := mergeBase(parents)
+		if err != nil {
+			return nil, fmt.Errorf("%w: merge base of %s: %w", ErrDiff, commit.Hash, err)
+		}
+		parser.logger.Infof("Merge commit %s has %d parents, diffing against their merge base %s",
+			commit.Hash, len(parents), base.Hash)
+		return parser.diffCommits(base, commit)
+	}
+
+	parser.logger.Infof("Merge commit %s has %d parents, diffing against the first parent %s",
+		commit.Hash, len(parents), parents[0].Hash)
+	return parser.diffCommits(parents[0], commit)
+}
+
+// Returns the best common ancestor of all of the passed commits
+func mergeBase(commits []*object.Commit) (*object.Commit, error) {
+	base := commits[0]
+	for _, commit := range commits[1:] {
+		bases, err := base.MergeBase(commit)
+		if err != nil {
+			return nil, err
+		}
+		if len(bases) == 0 {
+			return nil, fmt.Errorf("%s and %s have no common ancestor", base.Hash, commit.Hash)
+		}
+		base = bases[0]
+	}
+	return base, nil
+}
+
+// Combines the changes of a merge commit against each of its parents. A file
+// is only created if it is new to every parent; a file that already existed
+// in any parent is updated instead. Files deleted or renamed relative to any
+// parent are deleted or renamed.
+func unionChangeSets(changeSets []*ChangeSet) *ChangeSet {
+
+	createdCount := make(map[string]int)
+	updated := make(map[string]bool)
+	deleted := make(map[string]bool)
+	renamed := make(map[string]*Rename)
+	renamedFrom := make(map[string]bool)
+
+	for _, changeSet := range changeSets {
+		for _, file := range changeSet.Created {
+			createdCount[file]++
+		}
+		for _, file := range changeSet.Updated {
+			updated[file] = true
+		}
+		for _, file := range changeSet.Deleted {
+			deleted[file] = true
+		}
+		for _, rename := range changeSet.Renamed {
+			if _, ok := renamed[rename.To]; !ok {
+				renamed[rename.To] = rename
+				renamedFrom[rename.From] = true
+			}
+		}
+	}
+
+	union := NewEmptyChangeSet()
+	for file, count := range createdCount {
+		if _, ok := renamed[file]; ok {
+			continue
+		}
+		if count == len(changeSets) {
+			union.Created = append(union.Created, file)
+		} else {
+			updated[file] = true
+		}
+	}
+	for file := range updated {
+		if _, ok := renamed[file]; !ok {
+			union.Updated = append(union.Updated, file)
+		}
+	}
+	for file := range deleted {
+		if !renamedFrom[file] {
+			union.Deleted = append(union.Deleted, file)
+		}
+	}
+	for _, rename := range renamed {
+		union.Renamed = append(union.Renamed, rename)
+	}
+
+	slices.Sort(union.Created)
+	slices.Sort(union.Updated)
+	slices.Sort(union.Deleted)
+	slices.SortFunc(union.Renamed, func(a, b *Rename) int {
+		if a.To < b.To {
+			return -1
+		}
+		if a.To > b.To {
+			return 1
+		}
+		return 0
+	})
+
+	// A submodule changed relative to any parent is reported once
+	for _, changeSet := range changeSets {
+		for _, submodule := range changeSet.Submodules {
+			if !slices.ContainsFunc(union.Submodules, func(s *SubmoduleChange) bool {
+				return s.Path == submodule.Path
+			}) {
+				union.Submodules = append(union.Submodules, submodule)
+			}
+		}
+	}
+
+	// Combine the changes that did not match the filters the same way
+	filtered := make([]*ChangeSet, 0, len(changeSets))
+	for _, changeSet := range changeSets {
+		if changeSet.Filtered != nil {
+			filtered = append(filtered, changeSet.Filtered)
+		}
+	}
+	if len(filtered) == len(changeSets) {
+		union.Filtered = unionChangeSets(filtered)
+	}
+	return union
+}
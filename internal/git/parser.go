@@ -1,187 +1,295 @@
 package git
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"regexp"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/utils/merkletrie"
 	logging "github.com/op/go-logging"
 )
 
 type GitParser struct {
-	logger *logging.Logger
-	filter *regexp.Regexp
-	repo   *git.Repository
+	logger  *logging.Logger
+	options *ParserOptions
+	filter  *regexp.Regexp
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	repo    *git.Repository
+	tempDir string               // The temporary directory a remote repository was cloned into
+	auth    transport.AuthMethod // The authentication for cloning submodules of a remote repository
+	// The parsers for submodules, by path, opened when first needed
+	submodules map[string]*GitParser
 }
 
-// Parses a new local .git repository
-func NewLocalRepoParser(logger *logging.Logger, filter string) *GitParser {
-	r, err := git.PlainOpen("./.git")
-	if err != nil {
-		logger.Fatal(err)
+// Parses a local repository, discovering the repository that contains
+// the path by walking up its parent directories. The .git entry may be
+// a directory, or a file pointing to the git directory elsewhere, such
+// as in linked worktrees and submodules. File paths are always relative
+// to the root of the repository.
+func NewLocalRepoParser(logger *logging.Logger, path string, options *ParserOptions) (*GitParser, error) {
+	if path == "" {
+		path = "."
 	}
-	// Create an optimized, compiled pattern matcher for --filter option
-	var rFilter *regexp.Regexp
-	if filter != "" {
-		rFilter, err = regexp.Compile(filter)
-		if err != nil {
-			logger.Fatal(err)
-		}
+	r, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{
+		DetectDotGit:          true,
+		EnableDotGitCommonDir: true})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrRepositoryOpen, path, err)
 	}
-	return &GitParser{
-		logger: logger,
-		filter: rFilter,
-		repo:   r}
+	return newGitParser(logger, r, options)
 }
 
-// Parses a remote repository with a disk clone
-func NewRemotRepoParser(logger *logging.Logger, url string, filter string) *GitParser {
-	r, err := git.PlainClone("/tmp", false, &git.CloneOptions{URL: url})
-	if err != nil {
-		logger.Fatal(err)
+// Creates a parser for an opened repository, compiling the optimized
+// pattern matchers for the --filter, --include and --exclude options.
+func newGitParser(logger *logging.Logger, r *git.Repository, options *ParserOptions) (*GitParser, error) {
+	if options.RenameThreshold < 0 || options.RenameThreshold > 100 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidRenameThreshold, options.RenameThreshold)
+	}
+	switch options.MergeStrategy {
+	case "", MergeStrategyFirstParent, MergeStrategyUnion, MergeStrategyMergeBase:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMergeStrategy, options.MergeStrategy)
 	}
 	var rFilter *regexp.Regexp
-	if filter != "" {
-		rFilter, err = regexp.Compile(filter)
+	if options.Filter != "" {
+		var err error
+		rFilter, err = regexp.Compile(options.Filter)
 		if err != nil {
-			logger.Fatal(err)
+			return nil, fmt.Errorf("%w: %w", ErrInvalidFilter, err)
 		}
 	}
-	return &GitParser{
-		logger: logger,
-		filter: rFilter,
-		repo:   r}
-}
-
-// Parses a remote repository with an in-memory clone
-func NewRemoteMemoryRepoParser(logger *logging.Logger, url string, filter string) *GitParser {
-	r, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: url})
+	include, err := compileGlobs(options.Include)
 	if err != nil {
-		logger.Fatal(err)
+		return nil, err
 	}
-	var rFilter *regexp.Regexp
-	if filter != "" {
-		rFilter, err = regexp.Compile(filter)
-		if err != nil {
-			logger.Fatal(err)
-		}
+	exclude, err := compileGlobs(options.Exclude)
+	if err != nil {
+		return nil, err
 	}
 	return &GitParser{
-		logger: logger,
-		filter: rFilter,
-		repo:   r}
+		logger:     logger,
+		options:    options,
+		filter:     rFilter,
+		include:    include,
+		exclude:    exclude,
+		repo:       r,
+		submodules: make(map[string]*GitParser)}, nil
 }
 
-// Diffs the last commit to determine which files have been
-// created, modified, and/or deleted, and returns a ChangeSet
-// containing the relative file paths.
-func (parser *GitParser) Diff(targetHash string) *ChangeSet {
-
-	// The target hash plumbing.Hash
-	var pTargetHash plumbing.Hash
+// Returns the commit hash that HEAD points to
+func (parser *GitParser) Head() (string, error) {
+	return parser.ResolveCommit("HEAD")
+}
 
-	// Get HEAD branch
-	headRef, err := parser.repo.Head()
+// Returns the hash of the commit a revision (ex: HEAD, HEAD~3, a branch,
+// tag or commit hash) points to.
+func (parser *GitParser) ResolveCommit(revision string) (string, error) {
+	commit, err := parser.commit(revision)
 	if err != nil {
-		parser.logger.Fatal(err)
+		return "", err
 	}
+	return commit.Hash.String(), nil
+}
 
-	// Retrieve the commit instance
-	headCommit, err := parser.repo.CommitObject(headRef.Hash())
+// Resolves a revision to a commit, peeling annotated tags
+func (parser *GitParser) commit(revision string) (*object.Commit, error) {
+	hash, err := parser.repo.ResolveRevision(plumbing.Revision(revision))
 	if err != nil {
-		parser.logger.Fatal(err)
+		return nil, fmt.Errorf("%w: %s: %w", ErrRevision, revision, err)
 	}
-
-	// If HEAD doesn't have any parent hashes, this is a new repo
-	if len(headCommit.ParentHashes) == 0 {
-		return parser.parseInitialCommit(headCommit)
+	commit, err := parser.repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrRevision, revision, err)
 	}
+	return commit, nil
+}
 
-	// git ls-tree -r HEAD
-	headTree, err := headCommit.Tree()
+// Returns the files in the given revision that match the filters. With
+// RecurseSubmodules, the files in submodules already opened by a diff or
+// read are included, so listing never clones a submodule.
+func (parser *GitParser) ListFiles(revision string) ([]string, error) {
+	commit, err := parser.commit(revision)
 	if err != nil {
-		parser.logger.Fatal(err)
+		return nil, err
 	}
-
-	// Use the specified --commit if passed,
-	// otherwise default to HEAD's parent hash.
-	if targetHash == "" {
-		pTargetHash = headCommit.ParentHashes[0]
-	} else {
-		pTargetHash = plumbing.NewHash(targetHash)
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiff, err)
 	}
+	return parser.treeFiles(tree)
+}
 
-	// Show the git log commit message, author, etc for the HEAD
-	// commit (the commit to compare the HEAD commit with)
-	parser.logger.Debugf("Deploying HEAD commit %s...", headRef.Hash())
-	logIter, err := parser.repo.Log(&git.LogOptions{From: headRef.Hash()})
+// Returns the files in a tree that match the filters
+func (parser *GitParser) treeFiles(tree *object.Tree) ([]string, error) {
+	filter, err := parser.treeFilter(tree)
 	if err != nil {
-		parser.logger.Fatal(err)
-	}
-	// Loop over each commit
-	err = logIter.ForEach(func(c *object.Commit) error {
-		if c.Hash == headRef.Hash() {
-			// Show the commit log (author, message, etc)
-			parser.logger.Debugf("%+v+", c)
-			return nil
+		return nil, err
+	}
+	files := make([]string, 0)
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if filter.Match(f.Name) {
+			files = append(files, f.Name)
 		}
 		return nil
 	})
 	if err != nil {
-		parser.logger.Fatal(err)
+		return nil, fmt.Errorf("%w: %w", ErrDiff, err)
+	}
+	if parser.options.RecurseSubmodules {
+		nested, err := parser.submoduleFiles(tree)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range nested {
+			if filter.Match(file) {
+				files = append(files, file)
+			}
+		}
 	}
+	return files, nil
+}
 
-	// Show the git log commit message, author, etc for the target
-	// commit (the commit to compare the HEAD commit with)
-	parser.logger.Debugf("Diffing against target commit %s...", pTargetHash)
-	logIter, err = parser.repo.Log(&git.LogOptions{From: pTargetHash})
+// Returns the contents of a file as it exists in the given revision
+// (ex: HEAD, a branch, tag or commit hash), ignoring the working tree.
+// With RecurseSubmodules, files nested in submodules are read from the
+// submodule commit.
+func (parser *GitParser) ReadFile(revision, filePath string) ([]byte, error) {
+	commit, err := parser.commit(revision)
 	if err != nil {
-		parser.logger.Fatal(err)
-	}
-	// Loop over each commit
-	err = logIter.ForEach(func(c *object.Commit) error {
-		if c.Hash == pTargetHash {
-			// Show the commit log (author, message, etc)
-			parser.logger.Debugf("%+v+", c)
-			return nil
+		return nil, err
+	}
+	contents, err := parser.readFile(commit, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s@%s: %w", filePath, revision, err)
+	}
+	return contents, nil
+}
+
+// Returns the contents of a file in a commit
+func (parser *GitParser) readFile(commit *object.Commit, filePath string) ([]byte, error) {
+	file, err := commit.File(filePath)
+	if errors.Is(err, object.ErrFileNotFound) && parser.options.RecurseSubmodules {
+		tree, err := commit.Tree()
+		if err != nil {
+			return nil, err
 		}
-		return nil
-	})
+		return parser.readSubmoduleFile(tree, filePath)
+	}
 	if err != nil {
-		parser.logger.Fatal(err)
+		return nil, err
 	}
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(contents), nil
+}
 
-	// Retrieve the target commit instance
-	targetCommit, err := parser.repo.CommitObject(pTargetHash)
+// Diffs two revisions to determine which files have been created,
+// modified, deleted and/or renamed, and returns a ChangeSet containing
+// the relative file paths. Revisions may be any commit hash, branch,
+// tag or expression such as HEAD~3. The to revision defaults to HEAD,
+// and the from revision defaults to the first parent of the to revision.
+func (parser *GitParser) Diff(from, to string) (*ChangeSet, error) {
+
+	if to == "" {
+		to = "HEAD"
+	}
+
+	toCommit, err := parser.commit(to)
+	if err != nil {
+		return nil, err
+	}
+	parser.logger.Debugf("Deploying commit %s (%s)...", toCommit.Hash, to)
+
+	changeSet, err := parser.diffFrom(from, toCommit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the deployment directives in the commit message
+	changeSet.Directives = ParseDirectives(toCommit.Message)
+	if !changeSet.Directives.IsEmpty() {
+		parser.logger.Infof("Commit %s deployment directives: %s", toCommit.Hash, changeSet.Directives)
+	}
+	return changeSet, nil
+}
+
+// Diffs a commit against the from revision, or against its
+// parent(s) if from is empty.
+func (parser *GitParser) diffFrom(from string, toCommit *object.Commit) (*ChangeSet, error) {
+
+	var fromCommit *object.Commit
+	var err error
+	if from == "" {
+		// If the commit doesn't have any parent hashes, this is a new repo
+		if len(toCommit.ParentHashes) == 0 {
+			return parser.parseInitialCommit(toCommit)
+		}
+		if len(toCommit.ParentHashes) > 1 {
+			return parser.diffMerge(toCommit)
+		}
+		fromCommit, err = toCommit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s^: %w", ErrRevision, toCommit.Hash, err)
+		}
+	} else {
+		fromCommit, err = parser.commit(from)
+		if err != nil {
+			return nil, err
+		}
+	}
+	parser.logger.Debugf("Diffing against commit %s...", fromCommit.Hash)
+
+	return parser.diffCommits(fromCommit, toCommit)
+}
+
+// Diffs the trees of two commits
+func (parser *GitParser) diffCommits(fromCommit, toCommit *object.Commit) (*ChangeSet, error) {
+
+	// git ls-tree -r <from>
+	fromTree, err := fromCommit.Tree()
 	if err != nil {
-		parser.logger.Fatal(err)
+		return nil, fmt.Errorf("%w: %w", ErrDiff, err)
 	}
 
-	// git ls-tree -r targetHash
-	targetTree, err := targetCommit.Tree()
+	// git ls-tree -r <to>
+	toTree, err := toCommit.Tree()
 	if err != nil {
-		parser.logger.Fatal(err)
+		return nil, fmt.Errorf("%w: %w", ErrDiff, err)
 	}
 
-	// Diff HEAD against the requested --commit-hash, or the parent hash if empty
-	return parser.diff(headTree, targetTree)
+	return parser.diff(fromTree, toTree)
 }
 
-// Diff a tree against a commit hash and returns a ChangeSet that contains
-// all of the files that were created, modified, and/or deleted.
-func (parser *GitParser) diff(sourceTree *object.Tree, targetTree *object.Tree) *ChangeSet {
+// Diff a base tree against a head tree and returns a ChangeSet that contains
+// all of the files that were created, modified, deleted and/or renamed
+// in the head tree.
+func (parser *GitParser) diff(baseTree *object.Tree, headTree *object.Tree) (*ChangeSet, error) {
 
-	creates := make([]string, 0)
-	updates := make([]string, 0)
-	deletes := make([]string, 0)
+	changeSet := NewEmptyChangeSet()
+	filtered := NewEmptyChangeSet()
 
-	// Diff the two trees to get a change set
-	changes, err := sourceTree.Diff(targetTree)
+	filter, err := parser.treeFilter(headTree)
 	if err != nil {
-		parser.logger.Fatal(err)
+		return nil, err
+	}
+
+	// Diff the two trees to get a change set, pairing deleted and
+	// inserted files that are similar enough to be considered renames.
+	changes, err := object.DiffTreeWithOptions(context.Background(), baseTree, headTree,
+		&object.DiffTreeOptions{
+			DetectRenames: parser.options.RenameThreshold > 0,
+			RenameScore:   uint(parser.options.RenameThreshold)})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiff, err)
 	}
 
 	// Parse each of the file changes
@@ -189,65 +297,116 @@ func (parser *GitParser) diff(sourceTree *object.Tree, targetTree *object.Tree)
 
 		action, err := change.Action()
 		if err != nil {
-			parser.logger.Fatal(err)
+			return nil, fmt.Errorf("%w: %w", ErrDiff, err)
+		}
+
+		if isRename(change) {
+			rename := &Rename{From: change.From.Name, To: change.To.Name}
+			// A file moved out of the filters is a delete, and a file moved
+			// into them is a create, so excluded paths are never deployed
+			fromMatch, toMatch := filter.Match(change.From.Name), filter.Match(change.To.Name)
+			switch {
+			case fromMatch && toMatch:
+				parser.logger.Debugf("Detected rename %s -> %s", change.From.Name, change.To.Name)
+				changeSet.Renamed = append(changeSet.Renamed, rename)
+			case fromMatch:
+				changeSet.Deleted = append(changeSet.Deleted, rename.From)
+				filtered.Created = append(filtered.Created, rename.To)
+			case toMatch:
+				filtered.Deleted = append(filtered.Deleted, rename.From)
+				changeSet.Created = append(changeSet.Created, rename.To)
+			default:
+				filtered.Renamed = append(filtered.Renamed, rename)
+			}
+			continue
 		}
 
-		// Get the file name (even if its been renamed)
 		changeName := parser.changeName(change)
 
-		// If a filter is defined, only process this change
-		// if it matches the specified regexp pattern.
-		if parser.filter != nil {
-			if !parser.filter.MatchString(changeName) {
+		// A changed submodule is a gitlink, not a file. Its nested changes
+		// are only reported when recursing into submodules.
+		if isSubmodule(change) {
+			submodule := newSubmoduleChange(changeName, change)
+			changeSet.Submodules = append(changeSet.Submodules, submodule)
+			if !parser.options.RecurseSubmodules {
+				parser.logger.Warningf("Submodule %s changed (%s -> %s), use --recurse-submodules to deploy its templates",
+					changeName, shortHash(submodule.From), shortHash(submodule.To))
 				continue
 			}
+			if err := parser.diffSubmodule(submodule, baseTree, headTree, filter, changeSet, filtered); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Only process this change if it matches the filters,
+		// keeping the changes that do not match apart
+		target := changeSet
+		if !filter.Match(changeName) {
+			target = filtered
 		}
 
 		// Collect and organize changes based on the action type
 		switch action {
 		case merkletrie.Insert:
-			creates = append(creates, changeName)
+			target.Created = append(target.Created, changeName)
 		case merkletrie.Modify:
-			updates = append(updates, changeName)
+			target.Updated = append(target.Updated, changeName)
 		case merkletrie.Delete:
-			deletes = append(deletes, changeName)
+			target.Deleted = append(target.Deleted, changeName)
 		default:
-			parser.logger.Fatalf("unexpected git change action: %+v", action)
+			return nil, fmt.Errorf("%w: unexpected git change action: %+v", ErrDiff, action)
 		}
 	}
 
-	if err != nil {
-		parser.logger.Fatal(err)
-	}
-
 	// Return a ChangeSet that contains all of the files
-	// that have been created, modified, and/or deleted
+	// that have been created, modified, deleted and/or renamed
 	// since the requested --commit (plumbing.Hash).
-	return NewChangeSet(creates, updates, deletes)
+	changeSet.Filtered = filtered
+	return changeSet, nil
 }
 
 // Parses the an initial commit with no prior history
-func (parser *GitParser) parseInitialCommit(commit *object.Commit) *ChangeSet {
+func (parser *GitParser) parseInitialCommit(commit *object.Commit) (*ChangeSet, error) {
 
 	parser.logger.Debug("No previous commits found...")
 
-	empty := make([]string, 0)
-	creates := make([]string, 0)
-
 	tree, err := commit.Tree()
 	if err != nil {
-		parser.logger.Fatal(err)
+		return nil, fmt.Errorf("%w: %w", ErrDiff, err)
 	}
 
-	tree.Files().ForEach(func(f *object.File) error {
-		creates = append(creates, f.Name)
-		return nil
-	})
+	// Every file in the tree is created
+	return parser.diff(nil, tree)
+}
+
+// Returns the filter for changes in a tree, using the tree's ignore file
+func (parser *GitParser) treeFilter(tree *object.Tree) (*pathFilter, error) {
+	if tree == nil {
+		return parser.pathFilter(nil), nil
+	}
+	ignore, err := treeIgnorePatterns(tree)
+	if err != nil {
+		return nil, err
+	}
+	return parser.pathFilter(ignore), nil
+}
+
+// Returns the filter for changes using the passed ignore file patterns
+func (parser *GitParser) pathFilter(ignore gitignore.Matcher) *pathFilter {
+	return &pathFilter{
+		regexp:  parser.filter,
+		include: parser.include,
+		exclude: parser.exclude,
+		ignore:  ignore}
+}
 
-	return NewChangeSet(creates, empty, empty)
+// Returns true if a change moved a file to a new path
+func isRename(change *object.Change) bool {
+	return change.From.Name != "" && change.To.Name != "" && change.From.Name != change.To.Name
 }
 
-// Parses the file name from a change (the file may have been renamed)
+// Parses the file name from a change
 func (parser *GitParser) changeName(change *object.Change) string {
 	var empty = object.ChangeEntry{}
 	if change.From != empty {
@@ -0,0 +1,345 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	logging "github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// A repository in memory for building commits in tests
+type testRepo struct {
+	t        *testing.T
+	fs       billy.Filesystem
+	repo     *git.Repository
+	worktree *git.Worktree
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	fs := memfs.New()
+	repo, err := git.Init(memory.NewStorage(), fs)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+	return &testRepo{t: t, fs: fs, repo: repo, worktree: worktree}
+}
+
+func (r *testRepo) write(path, contents string) {
+	f, err := r.fs.Create(path)
+	assert.NoError(r.t, err)
+	_, err = f.Write([]byte(contents))
+	assert.NoError(r.t, err)
+	assert.NoError(r.t, f.Close())
+	_, err = r.worktree.Add(path)
+	assert.NoError(r.t, err)
+}
+
+func (r *testRepo) remove(path string) {
+	_, err := r.worktree.Remove(path)
+	assert.NoError(r.t, err)
+}
+
+func (r *testRepo) move(from, to string) {
+	_, err := r.worktree.Move(from, to)
+	assert.NoError(r.t, err)
+}
+
+func (r *testRepo) commit(message string) string {
+	hash, err := r.worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+	assert.NoError(r.t, err)
+	return hash.String()
+}
+
+// Creates a merge commit of the staged changes with the passed parents
+func (r *testRepo) merge(message string, parents ...string) string {
+	hashes := make([]plumbing.Hash, len(parents))
+	for i, parent := range parents {
+		hashes[i] = plumbing.NewHash(parent)
+	}
+	hash, err := r.worktree.Commit(message, &git.CommitOptions{
+		Author:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		Parents: hashes})
+	assert.NoError(r.t, err)
+	return hash.String()
+}
+
+// Resets the worktree and HEAD to the passed commit
+func (r *testRepo) reset(commit string) {
+	assert.NoError(r.t, r.worktree.Reset(&git.ResetOptions{
+		Commit: plumbing.NewHash(commit),
+		Mode:   git.HardReset}))
+}
+
+func (r *testRepo) head() string {
+	ref, err := r.repo.Head()
+	assert.NoError(r.t, err)
+	return ref.Hash().String()
+}
+
+func (r *testRepo) parser(options *ParserOptions) *GitParser {
+	parser, err := newGitParser(logging.MustGetLogger("test"), r.repo, options)
+	assert.NoError(r.t, err)
+	return parser
+}
+
+// Returns a template large enough for rename similarity to be meaningful
+func template(resource string) string {
+	return strings.Repeat("Resources:\n  "+resource+":\n    Type: AWS::EC2::VPC\n", 10)
+}
+
+func TestDiff(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	r.write("templates/web.template", template("Web"))
+	r.commit("initial")
+
+	r.write("templates/vpc.template", template("Vpc")+"Outputs: {}\n")
+	r.write("templates/db.template", template("Db"))
+	r.remove("templates/web.template")
+	r.commit("second")
+
+	changeSet, err := r.parser(&ParserOptions{}).Diff("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/db.template"}, changeSet.Created)
+	assert.Equal(t, []string{"templates/vpc.template"}, changeSet.Updated)
+	assert.Equal(t, []string{"templates/web.template"}, changeSet.Deleted)
+	assert.Empty(t, changeSet.Renamed)
+}
+
+func TestDiffDetectsRenames(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	r.commit("initial")
+
+	r.move("templates/vpc.template", "templates/network.template")
+	r.commit("rename")
+
+	changeSet, err := r.parser(&ParserOptions{RenameThreshold: DefaultRenameThreshold}).Diff("", "")
+	assert.NoError(t, err)
+	assert.Empty(t, changeSet.Created)
+	assert.Empty(t, changeSet.Deleted)
+	assert.Equal(t, []*Rename{{From: "templates/vpc.template", To: "templates/network.template"}},
+		changeSet.Renamed)
+
+	// Disabling rename detection reports a delete and a create
+	changeSet, err = r.parser(&ParserOptions{}).Diff("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/network.template"}, changeSet.Created)
+	assert.Equal(t, []string{"templates/vpc.template"}, changeSet.Deleted)
+	assert.Empty(t, changeSet.Renamed)
+}
+
+func TestDiffRenameFilterMatchesBothPaths(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	r.commit("initial")
+
+	r.move("templates/vpc.template", "templates/network/vpc.template")
+	r.commit("move")
+
+	changeSet, err := r.parser(&ParserOptions{
+		Filter:          "^templates/",
+		RenameThreshold: DefaultRenameThreshold}).Diff("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []*Rename{{From: "templates/vpc.template", To: "templates/network/vpc.template"}}, changeSet.Renamed)
+}
+
+func TestDiffRenameFilterMatchesOnePath(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/app.template", template("App"))
+	r.write("drafts/web.template", template("Web"))
+	r.commit("initial")
+
+	r.move("templates/app.template", "archive/app.template")
+	r.move("drafts/web.template", "templates/web.template")
+	r.commit("archive app, publish web")
+
+	for _, options := range []*ParserOptions{
+		{Exclude: []string{"archive/**", "drafts/**"}, RenameThreshold: DefaultRenameThreshold},
+		{Filter: "^templates/", RenameThreshold: DefaultRenameThreshold}} {
+
+		changeSet, err := r.parser(options).Diff("", "")
+		assert.NoError(t, err)
+
+		// Moving out of the filters deletes the stack, and
+		// the excluded path is never deployed
+		assert.Empty(t, changeSet.Renamed)
+		assert.Equal(t, []string{"templates/app.template"}, changeSet.Deleted)
+		assert.Equal(t, []string{"archive/app.template"}, changeSet.Filtered.Created)
+
+		// Moving into the filters creates the stack
+		assert.Equal(t, []string{"templates/web.template"}, changeSet.Created)
+		assert.Equal(t, []string{"drafts/web.template"}, changeSet.Filtered.Deleted)
+	}
+}
+
+func TestInvalidRenameThreshold(t *testing.T) {
+	r := newTestRepo(t)
+	_, err := newGitParser(logging.MustGetLogger("test"), r.repo, &ParserOptions{RenameThreshold: 101})
+	assert.ErrorIs(t, err, ErrInvalidRenameThreshold)
+}
+
+func TestDiffRevisionRange(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	first := r.commit("initial")
+
+	r.write("templates/db.template", template("Db"))
+	r.commit("add db")
+	_, err := r.repo.CreateTag("v1.0.0", plumbing.NewHash(r.head()), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		Message: "release"})
+	assert.NoError(t, err)
+
+	r.write("templates/web.template", template("Web"))
+	r.commit("add web")
+
+	parser := r.parser(&ParserOptions{})
+
+	// The to revision defaults to HEAD
+	changeSet, err := parser.Diff(first, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/db.template", "templates/web.template"}, changeSet.Created)
+
+	// The from revision defaults to the parent of the to revision
+	changeSet, err = parser.Diff("", "v1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/db.template"}, changeSet.Created)
+
+	changeSet, err = parser.Diff("HEAD~2", "HEAD~1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/db.template"}, changeSet.Created)
+
+	_, err = parser.Diff("", "missing")
+	assert.ErrorIs(t, err, ErrRevision)
+}
+
+func TestDiffMergeStrategies(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	r.write("templates/web.template", template("Web"))
+	base := r.commit("initial")
+
+	r.write("templates/db.template", template("Db"))
+	db := r.commit("add db")
+
+	r.reset(base)
+	r.write("templates/web.template", template("Web")+"Outputs: {}\n")
+	web := r.commit("update web")
+
+	r.reset(base)
+	r.write("templates/vpc.template", template("Vpc")+"Outputs: {}\n")
+	mainline := r.commit("update vpc")
+
+	// Octopus merge of all three branches
+	r.write("templates/db.template", template("Db"))
+	r.write("templates/web.template", template("Web")+"Outputs: {}\n")
+	merge := r.merge("merge", mainline, db, web)
+
+	tests := []struct {
+		strategy MergeStrategy
+		created  []string
+		updated  []string
+	}{
+		{"", []string{"templates/db.template"}, []string{"templates/web.template"}},
+		{MergeStrategyFirstParent, []string{"templates/db.template"}, []string{"templates/web.template"}},
+		{MergeStrategyMergeBase,
+			[]string{"templates/db.template"},
+			[]string{"templates/vpc.template", "templates/web.template"}},
+		{MergeStrategyUnion,
+			[]string{},
+			[]string{"templates/db.template", "templates/vpc.template", "templates/web.template"}},
+	}
+	for _, test := range tests {
+		parser := r.parser(&ParserOptions{MergeStrategy: test.strategy})
+		changeSet, err := parser.Diff("", merge)
+		assert.NoError(t, err, test.strategy)
+		assert.ElementsMatch(t, test.created, changeSet.Created, test.strategy)
+		assert.ElementsMatch(t, test.updated, changeSet.Updated, test.strategy)
+		assert.Empty(t, changeSet.Deleted, test.strategy)
+	}
+}
+
+func TestUnionCreatedInEveryParent(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	r.write("templates/app.template", template("App"))
+	base := r.commit("initial")
+
+	r.write("templates/web.template", template("Web"))
+	side := r.commit("add web")
+
+	r.reset(base)
+	r.remove("templates/vpc.template")
+	mainline := r.commit("delete vpc")
+
+	r.write("templates/web.template", template("Web"))
+	r.write("templates/db.template", template("Db"))
+	merge := r.merge("merge", mainline, side)
+
+	parser := r.parser(&ParserOptions{MergeStrategy: MergeStrategyUnion})
+	changeSet, err := parser.Diff("", merge)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/db.template"}, changeSet.Created)
+	assert.Equal(t, []string{"templates/web.template"}, changeSet.Updated)
+	assert.Equal(t, []string{"templates/vpc.template"}, changeSet.Deleted)
+}
+
+func TestInvalidMergeStrategy(t *testing.T) {
+	r := newTestRepo(t)
+	_, err := newGitParser(logging.MustGetLogger("test"), r.repo, &ParserOptions{MergeStrategy: "octopus"})
+	assert.ErrorIs(t, err, ErrInvalidMergeStrategy)
+}
+
+func TestNewLocalRepoParserDiscovery(t *testing.T) {
+	root := t.TempDir()
+	repo, err := git.PlainInit(root, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "templates", "network"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "templates", "network", "vpc.template"), []byte(template("Vpc")), 0644))
+	_, err = worktree.Add("templates/network/vpc.template")
+	assert.NoError(t, err)
+	_, err = worktree.Commit("initial", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+	assert.NoError(t, err)
+
+	logger := logging.MustGetLogger("test")
+
+	// Paths are relative to the repository root, from any subdirectory
+	parser, err := NewLocalRepoParser(logger, filepath.Join(root, "templates", "network"), &ParserOptions{})
+	assert.NoError(t, err)
+	changeSet, err := parser.Diff("", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/network/vpc.template"}, changeSet.Created)
+
+	// A .git file points to a git directory elsewhere
+	gitDir := filepath.Join(t.TempDir(), "repo.git")
+	assert.NoError(t, os.Rename(filepath.Join(root, ".git"), gitDir))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, ".git"), []byte("gitdir: "+gitDir+"\n"), 0644))
+
+	parser, err = NewLocalRepoParser(logger, filepath.Join(root, "templates"), &ParserOptions{})
+	assert.NoError(t, err)
+	changeSet, err = parser.Diff("", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/network/vpc.template"}, changeSet.Created)
+	changeSet, err = parser.DiffWorktree(false)
+	assert.NoError(t, err)
+	assert.Zero(t, changeSet.Len())
+
+	_, err = NewLocalRepoParser(logger, t.TempDir(), &ParserOptions{})
+	assert.ErrorIs(t, err, ErrRepositoryOpen)
+}
@@ -0,0 +1,153 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	logging "github.com/op/go-logging"
+)
+
+const defaultGitUser = "git"
+
+// Parses a remote repository, cloning a single branch or tag into a new
+// temporary directory, or into memory with remote.InMemory. The parser
+// must be closed to remove the temporary directory.
+func NewRemoteRepoParser(logger *logging.Logger, remote *RemoteOptions, options *ParserOptions) (*GitParser, error) {
+
+	auth, err := remote.authMethod()
+	if err != nil {
+		return nil, err
+	}
+
+	ref := remote.Ref
+	if ref == "" {
+		ref = "default branch"
+	}
+	logger.Infof("Cloning %s (%s)", redactURL(remote.URL), ref)
+
+	// A ref that is not a full reference name may be a branch or a tag
+	var r *git.Repository
+	var dir string
+	for _, ref := range remote.referenceNames() {
+		r, dir, err = clone(remote.InMemory, &git.CloneOptions{
+			URL:           remote.URL,
+			Auth:          auth,
+			ReferenceName: ref,
+			SingleBranch:  true,
+			Depth:         remote.Depth})
+		if !errors.As(err, &git.NoMatchingRefSpecError{}) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrRepositoryClone, redactURL(remote.URL), err)
+	}
+
+	parser, err := newGitParser(logger, r, options)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	parser.tempDir = dir
+	parser.auth = auth
+	return parser, nil
+}
+
+// Clones a repository into memory, or into a new temporary directory
+// that is returned with the repository. The directory is removed if
+// the clone fails.
+func clone(inMemory bool, options *git.CloneOptions) (*git.Repository, string, error) {
+	if inMemory {
+		r, err := git.Clone(memory.NewStorage(), nil, options)
+		return r, "", err
+	}
+	dir, err := os.MkdirTemp("", "gitformation-")
+	if err != nil {
+		return nil, "", err
+	}
+	r, err := git.PlainClone(dir, false, options)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+	return r, dir, nil
+}
+
+// Removes the temporary clone of a remote repository, if any
+func (parser *GitParser) Close() error {
+	if parser.tempDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(parser.tempDir)
+	parser.tempDir = ""
+	return err
+}
+
+// Returns the reference names to try cloning for the ref. A branch or
+// tag name is tried as a branch first, and then as a tag.
+func (remote *RemoteOptions) referenceNames() []plumbing.ReferenceName {
+	switch {
+	case remote.Ref == "":
+		return []plumbing.ReferenceName{""}
+	case strings.HasPrefix(remote.Ref, "refs/"):
+		return []plumbing.ReferenceName{plumbing.ReferenceName(remote.Ref)}
+	}
+	return []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(remote.Ref),
+		plumbing.NewTagReferenceName(remote.Ref)}
+}
+
+// Returns the authentication method for the remote: an SSH private key,
+// the SSH agent, or an HTTPS token. Returns nil to use the transport's
+// default authentication.
+func (remote *RemoteOptions) authMethod() (transport.AuthMethod, error) {
+	switch {
+	case remote.SSHKeyFile != "":
+		auth, err := ssh.NewPublicKeysFromFile(remote.sshUser(), remote.SSHKeyFile, remote.SSHKeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrRemoteAuth, remote.SSHKeyFile, err)
+		}
+		return auth, nil
+	case remote.SSHAgent:
+		auth, err := ssh.NewSSHAgentAuth(remote.sshUser())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrRemoteAuth, err)
+		}
+		return auth, nil
+	case remote.Token != "":
+		username := remote.Username
+		if username == "" {
+			username = defaultGitUser
+		}
+		return &http.BasicAuth{Username: username, Password: remote.Token}, nil
+	}
+	return nil, nil
+}
+
+// Returns the SSH user in the remote URL, or git by default
+func (remote *RemoteOptions) sshUser() string {
+	if endpoint, err := transport.NewEndpoint(remote.URL); err == nil && endpoint.User != "" {
+		return endpoint.User
+	}
+	return defaultGitUser
+}
+
+// Removes any credentials from a URL so it can be logged. Tokens are
+// often passed as the username, so the whole user info is removed.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = url.User("redacted")
+	return u.String()
+}
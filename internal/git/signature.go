@@ -0,0 +1,389 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+// The default locations of the trusted signing keys in the repository
+const (
+	DefaultKeyringFile        = ".gitformation/keyring.asc"
+	DefaultAllowedSignersFile = ".gitformation/allowed_signers"
+)
+
+const (
+	pgpSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+	sshSignatureHeader = "-----BEGIN SSH SIGNATURE-----"
+	sshSignatureFooter = "-----END SSH SIGNATURE-----"
+	// The preamble of SSH signatures and their signed data
+	sshSignatureMagic = "SSHSIG"
+	// The namespace git signs commits in
+	sshSignatureNamespace = "git"
+)
+
+// The keys trusted to sign the deployed commits
+type trustedKeys struct {
+	keyring        openpgp.EntityList
+	allowedSigners []*allowedSigner
+}
+
+// A key in an SSH allowed signers file
+type allowedSigner struct {
+	principals string
+	key        ssh.PublicKey
+}
+
+// The SSH signature blob, following the SSHSIG preamble
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// The data an SSH signature is made over, following the SSHSIG preamble
+type sshSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// Verifies that every commit being deployed carries a valid GPG or SSH
+// signature from a trusted key. If from is empty only the to commit is
+// verified, otherwise every commit reachable from to but not from from.
+// The trusted keys are never read from the commits being verified, since
+// any of them could add its own key. They are read from the repository at
+// options.Revision, or at the from commit if it is empty.
+func (parser *GitParser) VerifyCommits(from, to string, options *SignatureOptions) error {
+	if to == "" {
+		to = "HEAD"
+	}
+	revision := options.Revision
+	if revision == "" {
+		revision = from
+	}
+	if revision == "" {
+		return fmt.Errorf("%w: the keys must be read from a trusted revision outside the verified commits, "+
+			"such as a protected branch or the last deployment", ErrSigningKeys)
+	}
+	keysCommit, err := parser.commit(revision)
+	if err != nil {
+		return err
+	}
+	keys, err := parser.trustedKeys(keysCommit, options)
+	if err != nil {
+		return err
+	}
+	commits, err := parser.commitRange(from, to)
+	if err != nil {
+		return err
+	}
+	for _, commit := range commits {
+		// A key added by a verified commit must not be trusted to sign it
+		if parser.contains(keysCommit.Hash, commit) {
+			changed, err := changesFiles(commit, options.Keyring, options.AllowedSigners)
+			if err != nil {
+				return fmt.Errorf("%w: %s: %w", ErrSignature, commit.Hash, err)
+			}
+			if changed {
+				return fmt.Errorf("%w: commit %s changes the trusted keys read from %s, "+
+					"verify it with keys from an earlier revision", ErrSigningKeys, commit.Hash, revision)
+			}
+		}
+		signer, err := keys.verify(commit)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrSignature, commit.Hash, err)
+		}
+		parser.logger.Infof("Commit %s has a valid signature from %s", commit.Hash, signer)
+	}
+	return nil
+}
+
+// Returns true if a commit changed any of the files compared to its parents
+func changesFiles(commit *object.Commit, files ...string) (bool, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return false, err
+	}
+	parents := make([]*object.Tree, 0, commit.NumParents())
+	err = commit.Parents().ForEach(func(parent *object.Commit) error {
+		parentTree, err := parent.Tree()
+		if err != nil {
+			return err
+		}
+		parents = append(parents, parentTree)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(parents) == 0 {
+		parents = append(parents, &object.Tree{})
+	}
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		hash := blobHash(tree, file)
+		for _, parent := range parents {
+			if blobHash(parent, file) != hash {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Returns the hash of a file in a tree, or the zero hash if it does not exist
+func blobHash(tree *object.Tree, file string) plumbing.Hash {
+	entry, err := tree.FindEntry(file)
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+	return entry.Hash
+}
+
+// Returns the to commit, or every commit reachable from the to
+// commit that is not reachable from the from commit
+func (parser *GitParser) commitRange(from, to string) ([]*object.Commit, error) {
+	toCommit, err := parser.commit(to)
+	if err != nil {
+		return nil, err
+	}
+	if from == "" {
+		return []*object.Commit{toCommit}, nil
+	}
+	fromCommit, err := parser.commit(from)
+	if err != nil {
+		return nil, err
+	}
+
+	// git rev-list <from>..<to>
+	seen := make(map[plumbing.Hash]bool)
+	err = object.NewCommitPreorderIter(fromCommit, nil, nil).ForEach(func(c *object.Commit) error {
+		seen[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrRevision, from, err)
+	}
+	commits := make([]*object.Commit, 0)
+	err = object.NewCommitPreorderIter(toCommit, seen, nil).ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s..%s: %w", ErrRevision, from, to, err)
+	}
+	return commits, nil
+}
+
+// Reads the OpenPGP keyring and SSH allowed signers files from a
+// commit. Either file may be missing, but not both.
+func (parser *GitParser) trustedKeys(commit *object.Commit, options *SignatureOptions) (*trustedKeys, error) {
+	keys := &trustedKeys{}
+	if options.Keyring != "" {
+		contents, err := parser.readFile(commit, options.Keyring)
+		if err != nil && !errors.Is(err, object.ErrFileNotFound) {
+			return nil, fmt.Errorf("%w: %s: %w", ErrSigningKeys, options.Keyring, err)
+		}
+		if err == nil {
+			keys.keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(contents))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrSigningKeys, options.Keyring, err)
+			}
+		}
+	}
+	if options.AllowedSigners != "" {
+		contents, err := parser.readFile(commit, options.AllowedSigners)
+		if err != nil && !errors.Is(err, object.ErrFileNotFound) {
+			return nil, fmt.Errorf("%w: %s: %w", ErrSigningKeys, options.AllowedSigners, err)
+		}
+		if err == nil {
+			keys.allowedSigners, err = parseAllowedSigners(bytes.NewReader(contents))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrSigningKeys, options.AllowedSigners, err)
+			}
+		}
+	}
+	if len(keys.keyring) == 0 && len(keys.allowedSigners) == 0 {
+		return nil, fmt.Errorf("%w: no keys found in %s or %s at %s",
+			ErrSigningKeys, options.Keyring, options.AllowedSigners, commit.Hash)
+	}
+	return keys, nil
+}
+
+// Verifies the signature of a commit, returning the identity of the signer
+func (keys *trustedKeys) verify(commit *object.Commit) (string, error) {
+	signature := strings.TrimSpace(commit.PGPSignature)
+	switch {
+	case signature == "":
+		return "", errors.New("commit is not signed")
+	case strings.HasPrefix(signature, pgpSignatureHeader):
+		if len(keys.keyring) == 0 {
+			return "", errors.New("commit has a GPG signature, but the keyring is empty")
+		}
+		message, err := unsignedCommit(commit)
+		if err != nil {
+			return "", err
+		}
+		entity, err := openpgp.CheckArmoredDetachedSignature(
+			keys.keyring, bytes.NewReader(message), strings.NewReader(signature), nil)
+		if err != nil {
+			return "", err
+		}
+		if identity := entity.PrimaryIdentity(); identity != nil {
+			return identity.Name, nil
+		}
+		return fmt.Sprintf("key %X", entity.PrimaryKey.KeyId), nil
+	case strings.HasPrefix(signature, sshSignatureHeader):
+		if len(keys.allowedSigners) == 0 {
+			return "", errors.New("commit has an SSH signature, but there are no allowed signers")
+		}
+		message, err := unsignedCommit(commit)
+		if err != nil {
+			return "", err
+		}
+		return keys.verifySSH(message, signature)
+	default:
+		return "", errors.New("unsupported signature format")
+	}
+}
+
+// Verifies an armored SSH signature over a message, as created by
+// ssh-keygen -Y sign, returning the principals of the allowed signer
+func (keys *trustedKeys) verifySSH(message []byte, armored string) (string, error) {
+	encoded := strings.TrimSuffix(strings.TrimPrefix(armored, sshSignatureHeader), sshSignatureFooter)
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return "", fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	if !bytes.HasPrefix(blob, []byte(sshSignatureMagic)) {
+		return "", errors.New("invalid SSH signature: missing preamble")
+	}
+	var signature sshSignature
+	if err := ssh.Unmarshal(blob[len(sshSignatureMagic):], &signature); err != nil {
+		return "", fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	if signature.Version != 1 {
+		return "", fmt.Errorf("unsupported SSH signature version %d", signature.Version)
+	}
+	if signature.Namespace != sshSignatureNamespace {
+		return "", fmt.Errorf("SSH signature namespace is %q, not %q", signature.Namespace, sshSignatureNamespace)
+	}
+	key, err := ssh.ParsePublicKey(signature.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid SSH signature key: %w", err)
+	}
+	var signer *allowedSigner
+	for _, allowed := range keys.allowedSigners {
+		if bytes.Equal(allowed.key.Marshal(), key.Marshal()) {
+			signer = allowed
+			break
+		}
+	}
+	if signer == nil {
+		return "", fmt.Errorf("SSH key %s is not an allowed signer", ssh.FingerprintSHA256(key))
+	}
+
+	var h hash.Hash
+	switch signature.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("unsupported SSH signature hash algorithm %s", signature.HashAlgorithm)
+	}
+	h.Write(message)
+
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(signature.Signature, &sig); err != nil {
+		return "", fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(sshSignedData{
+		Namespace:     signature.Namespace,
+		Reserved:      signature.Reserved,
+		HashAlgorithm: signature.HashAlgorithm,
+		Hash:          h.Sum(nil)})...)
+	if err := key.Verify(signed, &sig); err != nil {
+		return "", err
+	}
+	return signer.principals, nil
+}
+
+// Returns the encoded commit without its signature, which is the
+// message the signature was made over
+func unsignedCommit(commit *object.Commit) ([]byte, error) {
+	encoded := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(encoded); err != nil {
+		return nil, err
+	}
+	reader, err := encoded.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+// Parses an SSH allowed signers file, as used by git's gpg.ssh.allowedSignersFile.
+// Each line lists the principals, optional options and a public key. Keys
+// limited to namespaces other than git, and certificate authorities, are
+// not supported and are skipped.
+func parseAllowedSigners(reader io.Reader) ([]*allowedSigner, error) {
+	signers := make([]*allowedSigner, 0)
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		principals, rest, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing public key", line)
+		}
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(rest)))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !allowsGitNamespace(options) {
+			continue
+		}
+		signers = append(signers, &allowedSigner{principals: principals, key: key})
+	}
+	return signers, scanner.Err()
+}
+
+// Returns true if the allowed signer options permit signing commits
+func allowsGitNamespace(options []string) bool {
+	for _, option := range options {
+		name, value, _ := strings.Cut(option, "=")
+		switch strings.ToLower(name) {
+		case "cert-authority":
+			return false
+		case "namespaces":
+			namespaces := strings.Split(strings.Trim(value, `"`), ",")
+			if !slices.Contains(namespaces, sshSignatureNamespace) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,220 @@
+package git
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// Signs commits the way ssh-keygen -Y sign -n git does
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+func newSSHSigner(t *testing.T) *sshSigner {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.NoError(t, err)
+	return &sshSigner{signer: signer}
+}
+
+func (s *sshSigner) Sign(message io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, err
+	}
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(sshSignedData{
+		Namespace:     sshSignatureNamespace,
+		HashAlgorithm: "sha512",
+		Hash:          h.Sum(nil)})...)
+	sig, err := s.signer.Sign(rand.Reader, signed)
+	if err != nil {
+		return nil, err
+	}
+	blob := append([]byte(sshSignatureMagic), ssh.Marshal(sshSignature{
+		Version:       1,
+		PublicKey:     s.signer.PublicKey().Marshal(),
+		Namespace:     sshSignatureNamespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig)})...)
+	return []byte(sshSignatureHeader + "\n" + base64.StdEncoding.EncodeToString(blob) + "\n" + sshSignatureFooter + "\n"), nil
+}
+
+// Returns an allowed signers line for the signer's public key
+func (s *sshSigner) allowedSigner(principal string) string {
+	return principal + " " + string(ssh.MarshalAuthorizedKey(s.signer.PublicKey()))
+}
+
+// Returns the armored public keyring of an OpenPGP entity
+func armoredKeyring(t *testing.T, entity *openpgp.Entity) string {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, entity.Serialize(w))
+	assert.NoError(t, w.Close())
+	return buf.String()
+}
+
+// Creates a commit of the staged changes signed by the signer
+func (r *testRepo) signedCommit(message string, signer git.Signer) string {
+	hash, err := r.worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		Signer: signer})
+	assert.NoError(r.t, err)
+	return hash.String()
+}
+
+func TestVerifyCommitsGPG(t *testing.T) {
+	trusted, err := openpgp.NewEntity("Deployer", "", "deployer@example.com", nil)
+	assert.NoError(t, err)
+	untrusted, err := openpgp.NewEntity("Mallory", "", "mallory@example.com", nil)
+	assert.NoError(t, err)
+
+	r := newTestRepo(t)
+	r.write(DefaultKeyringFile, armoredKeyring(t, trusted))
+	base := r.commit("add keyring")
+	r.write("templates/vpc.template", template("Vpc"))
+	first, err := r.worktree.Commit("initial", &git.CommitOptions{
+		Author:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		SignKey: trusted})
+	assert.NoError(t, err)
+
+	options := &SignatureOptions{Keyring: DefaultKeyringFile, AllowedSigners: DefaultAllowedSignersFile}
+	parser := r.parser(&ParserOptions{})
+	assert.NoError(t, parser.VerifyCommits(base, "HEAD", options))
+
+	// Every commit in the range must be signed by a trusted key
+	r.write("templates/db.template", template("Db"))
+	_, err = r.worktree.Commit("untrusted", &git.CommitOptions{
+		Author:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		SignKey: untrusted})
+	assert.NoError(t, err)
+	r.write("templates/web.template", template("Web"))
+	_, err = r.worktree.Commit("trusted", &git.CommitOptions{
+		Author:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		SignKey: trusted})
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, parser.VerifyCommits(first.String(), "HEAD", options), ErrSignature)
+
+	// Without a range, only the to commit is verified
+	options.Revision = base
+	assert.NoError(t, parser.VerifyCommits("", "HEAD", options))
+	assert.ErrorIs(t, parser.VerifyCommits("", "HEAD~1", options), ErrSignature)
+
+	// Unsigned commits are rejected
+	r.write("templates/app.template", template("App"))
+	r.commit("unsigned")
+	err = parser.VerifyCommits("", "HEAD", options)
+	assert.ErrorIs(t, err, ErrSignature)
+	assert.Contains(t, err.Error(), "not signed")
+}
+
+func TestVerifyCommitsSSH(t *testing.T) {
+	trusted := newSSHSigner(t)
+	untrusted := newSSHSigner(t)
+
+	r := newTestRepo(t)
+	r.write(DefaultAllowedSignersFile, "# deployers\n"+trusted.allowedSigner("deployer@example.com"))
+	base := r.commit("add allowed signers")
+	r.write("templates/vpc.template", template("Vpc"))
+	r.signedCommit("initial", trusted)
+
+	options := &SignatureOptions{Keyring: DefaultKeyringFile, AllowedSigners: DefaultAllowedSignersFile}
+	parser := r.parser(&ParserOptions{})
+	assert.NoError(t, parser.VerifyCommits(base, "", options))
+
+	r.write("templates/db.template", template("Db"))
+	r.signedCommit("untrusted", untrusted)
+	err := parser.VerifyCommits(base, "", options)
+	assert.ErrorIs(t, err, ErrSignature)
+	assert.Contains(t, err.Error(), "not an allowed signer")
+}
+
+func TestVerifyCommitsRejectsSelfAddedSigner(t *testing.T) {
+	trusted := newSSHSigner(t)
+	mallory := newSSHSigner(t)
+
+	r := newTestRepo(t)
+	r.write(DefaultAllowedSignersFile, trusted.allowedSigner("deployer@example.com"))
+	r.write("templates/vpc.template", template("Vpc"))
+	base := r.signedCommit("initial", trusted)
+
+	// A commit adds its own key to the allowed signers and signs with it
+	r.write(DefaultAllowedSignersFile, trusted.allowedSigner("deployer@example.com")+
+		mallory.allowedSigner("mallory@example.com"))
+	r.write("templates/db.template", template("Db"))
+	r.signedCommit("trust mallory", mallory)
+
+	options := &SignatureOptions{Keyring: DefaultKeyringFile, AllowedSigners: DefaultAllowedSignersFile}
+	parser := r.parser(&ParserOptions{})
+
+	// The keys are read from the from commit, which does not trust the key
+	err := parser.VerifyCommits(base, "HEAD", options)
+	assert.ErrorIs(t, err, ErrSignature)
+	assert.Contains(t, err.Error(), "not an allowed signer")
+
+	// Keys are never read from the verified commit by default
+	assert.ErrorIs(t, parser.VerifyCommits("", "HEAD", options), ErrSigningKeys)
+
+	// Keys read from a revision containing the change are rejected
+	options.Revision = "HEAD"
+	err = parser.VerifyCommits(base, "HEAD", options)
+	assert.ErrorIs(t, err, ErrSigningKeys)
+	assert.Contains(t, err.Error(), "changes the trusted keys")
+
+	// A key change signed by a previously trusted key is allowed
+	r.reset(base)
+	r.write(DefaultAllowedSignersFile, trusted.allowedSigner("deployer@example.com")+
+		mallory.allowedSigner("mallory@example.com"))
+	r.signedCommit("trust mallory", trusted)
+	options.Revision = ""
+	assert.NoError(t, parser.VerifyCommits(base, "HEAD", options))
+}
+
+func TestVerifyCommitsWithoutKeys(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	base := r.commit("initial")
+	r.write("templates/db.template", template("Db"))
+	r.signedCommit("add db", newSSHSigner(t))
+
+	err := r.parser(&ParserOptions{}).VerifyCommits(base, "", &SignatureOptions{
+		Keyring:        DefaultKeyringFile,
+		AllowedSigners: DefaultAllowedSignersFile})
+	assert.ErrorIs(t, err, ErrSigningKeys)
+}
+
+func TestParseAllowedSigners(t *testing.T) {
+	signer := newSSHSigner(t)
+	key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.signer.PublicKey())))
+
+	signers, err := parseAllowedSigners(strings.NewReader(strings.Join([]string{
+		"# comment",
+		"",
+		"a@example.com " + key + " laptop",
+		`b@example.com,c@example.com namespaces="git,file" ` + key,
+		`d@example.com namespaces="file" ` + key,
+		"*@example.com cert-authority " + key}, "\n")))
+	assert.NoError(t, err)
+	assert.Len(t, signers, 2)
+	assert.Equal(t, "a@example.com", signers[0].principals)
+	assert.Equal(t, "b@example.com,c@example.com", signers[1].principals)
+
+	_, err = parseAllowedSigners(strings.NewReader("a@example.com"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,330 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// The file that maps submodule paths to their repository URLs
+const gitModulesFile = ".gitmodules"
+
+// A submodule whose commit changed. From is empty for an added
+// submodule, and To is empty for a removed submodule.
+type SubmoduleChange struct {
+	Path string `yaml:"path" json:"path"`
+	From string `yaml:"from,omitempty" json:"from,omitempty"`
+	To   string `yaml:"to,omitempty" json:"to,omitempty"`
+}
+
+// Returns true if either side of a change is a submodule (gitlink)
+func isSubmodule(change *object.Change) bool {
+	return change.From.TreeEntry.Mode == filemode.Submodule ||
+		change.To.TreeEntry.Mode == filemode.Submodule
+}
+
+// Returns the submodule path and the old and new commits of a change
+func newSubmoduleChange(name string, change *object.Change) *SubmoduleChange {
+	submodule := &SubmoduleChange{Path: name}
+	if change.From.TreeEntry.Mode == filemode.Submodule {
+		submodule.From = change.From.TreeEntry.Hash.String()
+	}
+	if change.To.TreeEntry.Mode == filemode.Submodule {
+		submodule.To = change.To.TreeEntry.Hash.String()
+	}
+	return submodule
+}
+
+// Diffs the old and new commits of a changed submodule, adding the nested
+// files to the change set, or to the filtered changes if they do not match
+// the parent's filters. The submodule's own ignore file also applies.
+func (parser *GitParser) diffSubmodule(
+	submodule *SubmoduleChange,
+	baseTree, headTree *object.Tree,
+	filter *pathFilter,
+	changeSet, filtered *ChangeSet) error {
+
+	// The .gitmodules entry is read from the side the submodule exists on
+	tree := headTree
+	if submodule.To == "" {
+		tree = baseTree
+	}
+	subParser, err := parser.submoduleParser(submodule.Path, tree, submodule.From, submodule.To)
+	if err != nil {
+		return err
+	}
+	fromTree, err := subParser.commitTree(submodule.From)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrSubmodule, submodule.Path, err)
+	}
+	toTree, err := subParser.commitTree(submodule.To)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrSubmodule, submodule.Path, err)
+	}
+	nested, err := subParser.diff(fromTree, toTree)
+	if err != nil {
+		return err
+	}
+	parser.logger.Infof("Submodule %s changed (%s -> %s), %d nested changes",
+		submodule.Path, shortHash(submodule.From), shortHash(submodule.To), nested.Len())
+
+	prefix := func(file string) string {
+		return path.Join(submodule.Path, file)
+	}
+	route := func(file string) *ChangeSet {
+		if filter.Match(file) {
+			return changeSet
+		}
+		return filtered
+	}
+	for _, file := range nested.Created {
+		target := route(prefix(file))
+		target.Created = append(target.Created, prefix(file))
+	}
+	for _, file := range nested.Updated {
+		target := route(prefix(file))
+		target.Updated = append(target.Updated, prefix(file))
+	}
+	for _, file := range nested.Deleted {
+		target := route(prefix(file))
+		target.Deleted = append(target.Deleted, prefix(file))
+	}
+	for _, rename := range nested.Renamed {
+		rename := &Rename{From: prefix(rename.From), To: prefix(rename.To)}
+		if filter.Match(rename.From) || filter.Match(rename.To) {
+			changeSet.Renamed = append(changeSet.Renamed, rename)
+		} else {
+			filtered.Renamed = append(filtered.Renamed, rename)
+		}
+	}
+
+	// Files ignored by the submodule stay filtered
+	filtered.Created = append(filtered.Created, prefixAll(submodule.Path, nested.Filtered.Created)...)
+	filtered.Updated = append(filtered.Updated, prefixAll(submodule.Path, nested.Filtered.Updated)...)
+	filtered.Deleted = append(filtered.Deleted, prefixAll(submodule.Path, nested.Filtered.Deleted)...)
+	for _, rename := range nested.Filtered.Renamed {
+		filtered.Renamed = append(filtered.Renamed, &Rename{From: prefix(rename.From), To: prefix(rename.To)})
+	}
+
+	// Nested submodules are reported relative to this repository
+	for _, nestedSubmodule := range nested.Submodules {
+		changeSet.Submodules = append(changeSet.Submodules, &SubmoduleChange{
+			Path: prefix(nestedSubmodule.Path),
+			From: nestedSubmodule.From,
+			To:   nestedSubmodule.To})
+	}
+	return nil
+}
+
+// Returns the files in the submodules of a tree, relative to this
+// repository, that match the filters of each submodule. Only submodules
+// that were already opened, such as those a diff found changed, are
+// listed, so unchanged submodules are not cloned on every run.
+func (parser *GitParser) submoduleFiles(tree *object.Tree) ([]string, error) {
+	files := make([]string, 0)
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("%w: %w", ErrDiff, err)
+		}
+		if entry.Mode != filemode.Submodule {
+			continue
+		}
+		subParser, ok := parser.submodules[name]
+		if !ok {
+			parser.logger.Debugf("Not listing the files in unchanged submodule %s", name)
+			continue
+		}
+		subTree, err := subParser.commitTree(entry.Hash.String())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrSubmodule, name, err)
+		}
+		nested, err := subParser.treeFiles(subTree)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, prefixAll(name, nested)...)
+	}
+	return files, nil
+}
+
+// Reads a file nested in a submodule of a tree, or returns
+// object.ErrFileNotFound if the path is not inside a submodule
+func (parser *GitParser) readSubmoduleFile(tree *object.Tree, filePath string) ([]byte, error) {
+	segments := strings.Split(filePath, "/")
+	for i := 1; i < len(segments); i++ {
+		name := strings.Join(segments[:i], "/")
+		entry, err := tree.FindEntry(name)
+		if err != nil {
+			break
+		}
+		if entry.Mode != filemode.Submodule {
+			continue
+		}
+		subParser, err := parser.submoduleParser(name, tree, entry.Hash.String())
+		if err != nil {
+			return nil, err
+		}
+		commit, err := subParser.repo.CommitObject(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrSubmodule, name, err)
+		}
+		return subParser.readFile(commit, strings.Join(segments[i:], "/"))
+	}
+	return nil, object.ErrFileNotFound
+}
+
+// Returns the parser for a submodule, opening its repository the first
+// time it is needed. The tree provides the submodule URL if it has to
+// be cloned, and the commits must exist in the submodule repository.
+func (parser *GitParser) submoduleParser(name string, tree *object.Tree, commits ...string) (*GitParser, error) {
+	if subParser, ok := parser.submodules[name]; ok {
+		return subParser, nil
+	}
+	r, err := parser.submoduleRepository(name, tree, commits)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrSubmodule, name, err)
+	}
+	subParser, err := newGitParser(parser.logger, r, &ParserOptions{
+		RenameThreshold:   parser.options.RenameThreshold,
+		RecurseSubmodules: true})
+	if err != nil {
+		return nil, err
+	}
+	subParser.auth = parser.auth
+	parser.submodules[name] = subParser
+	return subParser, nil
+}
+
+// Opens the checked out submodule repository if it contains the commits,
+// otherwise clones the submodule URL in the .gitmodules file into memory
+func (parser *GitParser) submoduleRepository(name string, tree *object.Tree, commits []string) (*git.Repository, error) {
+	if worktree, err := parser.repo.Worktree(); err == nil {
+		if submodules, err := worktree.Submodules(); err == nil {
+			for _, submodule := range submodules {
+				if submodule.Config().Path != name {
+					continue
+				}
+				if r, err := submodule.Repository(); err == nil && hasCommits(r, commits) {
+					parser.logger.Debugf("Using the checked out submodule %s", name)
+					return r, nil
+				}
+			}
+		}
+	}
+	url, err := parser.submoduleURL(name, tree)
+	if err != nil {
+		return nil, err
+	}
+	parser.logger.Infof("Cloning submodule %s from %s", name, redactURL(url))
+	return git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: url, Auth: parser.auth})
+}
+
+// Returns the URL of a submodule from the .gitmodules file in a tree.
+// Relative URLs are resolved against the origin remote.
+func (parser *GitParser) submoduleURL(name string, tree *object.Tree) (string, error) {
+	if tree == nil {
+		return "", fmt.Errorf("%s not found", gitModulesFile)
+	}
+	file, err := tree.File(gitModulesFile)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", gitModulesFile, err)
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", gitModulesFile, err)
+	}
+	modules := config.NewModules()
+	if err := modules.Unmarshal([]byte(contents)); err != nil {
+		return "", fmt.Errorf("%s: %w", gitModulesFile, err)
+	}
+	for _, submodule := range modules.Submodules {
+		if submodule.Path != name {
+			continue
+		}
+		if !strings.HasPrefix(submodule.URL, "./") && !strings.HasPrefix(submodule.URL, "../") {
+			return submodule.URL, nil
+		}
+		remote, err := parser.repo.Remote(git.DefaultRemoteName)
+		if err != nil || len(remote.Config().URLs) == 0 {
+			return "", fmt.Errorf("relative submodule URL %s requires an %s remote", submodule.URL, git.DefaultRemoteName)
+		}
+		return resolveSubmoduleURL(remote.Config().URLs[0], submodule.URL), nil
+	}
+	return "", fmt.Errorf("no submodule with path %s in %s", name, gitModulesFile)
+}
+
+// Resolves a relative submodule URL (ex: ../shared.git) against the URL
+// of the superproject, as git submodule does
+func resolveSubmoduleURL(base, relative string) string {
+	base = strings.TrimSuffix(base, "/")
+	// scp-like URLs (ex: git@github.com:org/infra.git)
+	if !strings.Contains(base, "://") {
+		if host, repoPath, ok := strings.Cut(base, ":"); ok && !strings.Contains(host, "/") {
+			return host + ":" + path.Join(repoPath, relative)
+		}
+		return path.Join(base, relative)
+	}
+	scheme, rest, _ := strings.Cut(base, "://")
+	host, repoPath, _ := strings.Cut(rest, "/")
+	return scheme + "://" + host + path.Join("/", repoPath, relative)
+}
+
+// Returns the tree of a commit, or nil if the hash is empty
+func (parser *GitParser) commitTree(hash string) (*object.Tree, error) {
+	if hash == "" {
+		return nil, nil
+	}
+	commit, err := parser.repo.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree()
+}
+
+// Returns true if the repository contains all of the commits
+func hasCommits(r *git.Repository, commits []string) bool {
+	for _, hash := range commits {
+		if hash == "" {
+			continue
+		}
+		if _, err := r.CommitObject(plumbing.NewHash(hash)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the files with a directory prepended
+func prefixAll(dir string, files []string) []string {
+	prefixed := make([]string, 0, len(files))
+	for _, file := range files {
+		prefixed = append(prefixed, path.Join(dir, file))
+	}
+	return prefixed
+}
+
+// Returns the abbreviated form of a commit hash, or "none" if empty
+func shortHash(hash string) string {
+	if hash == "" {
+		return "none"
+	}
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
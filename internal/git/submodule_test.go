@@ -0,0 +1,118 @@
+package git
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// Stages a submodule (gitlink) at the path pointing to the commit
+func (r *testRepo) gitlink(path, commit string) {
+	idx, err := r.repo.Storer.Index()
+	assert.NoError(r.t, err)
+	entry, err := idx.Entry(path)
+	if err != nil {
+		entry = idx.Add(path)
+	}
+	entry.Mode = filemode.Submodule
+	entry.Hash = plumbing.NewHash(commit)
+	assert.NoError(r.t, r.repo.Storer.SetIndex(idx))
+}
+
+// Creates a superproject with the shared templates of newBareRemote as a
+// submodule, bumping the submodule from the v1 tag to the latest commit
+func newSuperproject(t *testing.T) *testRepo {
+	url := newBareRemote(t)
+	shared, err := NewRemoteRepoParser(logging.MustGetLogger("test"), &RemoteOptions{URL: url, InMemory: true}, &ParserOptions{})
+	assert.NoError(t, err)
+	v1, err := shared.ResolveCommit("v1")
+	assert.NoError(t, err)
+	head, err := shared.Head()
+	assert.NoError(t, err)
+
+	r := newTestRepo(t)
+	r.write(".gitmodules", fmt.Sprintf("[submodule \"shared\"]\n\tpath = vendor/shared\n\turl = %s\n", url))
+	r.write("templates/app.template", template("App"))
+	r.gitlink("vendor/shared", v1)
+	r.commit("add shared templates")
+	r.gitlink("vendor/shared", head)
+	r.commit("bump shared templates")
+	return r
+}
+
+func TestDiffSubmodule(t *testing.T) {
+	r := newSuperproject(t)
+
+	// The gitlink is reported as a submodule change, not as a file
+	changeSet, err := r.parser(&ParserOptions{}).Diff("", "")
+	assert.NoError(t, err)
+	assert.Empty(t, changeSet.Updated)
+	assert.Len(t, changeSet.Submodules, 1)
+	assert.Equal(t, "vendor/shared", changeSet.Submodules[0].Path)
+	assert.NotEmpty(t, changeSet.Submodules[0].From)
+	assert.NotEmpty(t, changeSet.Submodules[0].To)
+
+	// Recursing reports the nested template paths
+	parser := r.parser(&ParserOptions{RecurseSubmodules: true})
+	changeSet, err = parser.Diff("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vendor/shared/templates/web.template"}, changeSet.Created)
+	assert.Len(t, changeSet.Submodules, 1)
+
+	contents, err := parser.ReadFile("HEAD", "vendor/shared/templates/web.template")
+	assert.NoError(t, err)
+	assert.Equal(t, template("Web"), string(contents))
+
+	files, err := parser.ListFiles("HEAD")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		".gitmodules",
+		"templates/app.template",
+		"vendor/shared/templates/db.template",
+		"vendor/shared/templates/vpc.template",
+		"vendor/shared/templates/web.template"}, files)
+
+	// Unchanged submodules are not opened to list their files
+	parser = r.parser(&ParserOptions{RecurseSubmodules: true})
+	files, err = parser.ListFiles("HEAD")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{".gitmodules", "templates/app.template"}, files)
+	assert.Empty(t, parser.submodules)
+
+	// The parent's filters apply to nested files
+	changeSet, err = r.parser(&ParserOptions{
+		RecurseSubmodules: true,
+		Exclude:           []string{"vendor/**"}}).Diff("", "")
+	assert.NoError(t, err)
+	assert.Empty(t, changeSet.Created)
+	assert.Equal(t, []string{"vendor/shared/templates/web.template"}, changeSet.Filtered.Created)
+}
+
+func TestDiffInitialCommitSubmodule(t *testing.T) {
+	r := newSuperproject(t)
+
+	changeSet, err := r.parser(&ParserOptions{
+		RecurseSubmodules: true,
+		Include:           []string{"**/*.template"}}).Diff("", "HEAD~1")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"templates/app.template",
+		"vendor/shared/templates/db.template",
+		"vendor/shared/templates/vpc.template"}, changeSet.Created)
+	assert.Equal(t, []string{".gitmodules"}, changeSet.Filtered.Created)
+}
+
+func TestResolveSubmoduleURL(t *testing.T) {
+	assert.Equal(t, "https://github.com/org/shared.git",
+		resolveSubmoduleURL("https://github.com/org/infra.git", "../shared.git"))
+	assert.Equal(t, "https://github.com/org/infra.git/shared",
+		resolveSubmoduleURL("https://github.com/org/infra.git/", "./shared"))
+	assert.Equal(t, "git@github.com:org/shared.git",
+		resolveSubmoduleURL("git@github.com:org/infra.git", "../shared.git"))
+	assert.Equal(t, "/srv/git/shared.git",
+		resolveSubmoduleURL("/srv/git/infra.git", "../shared.git"))
+}
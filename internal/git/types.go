@@ -0,0 +1,47 @@
+package git
+
+// The default similarity, as a percentage, a deleted and created file must
+// share to be reported as a rename. This matches the default of git diff -M.
+const DefaultRenameThreshold = 50
+
+// How the changes in a merge commit are determined
+type MergeStrategy string
+
+const (
+	// Diff against the first (mainline) parent
+	MergeStrategyFirstParent MergeStrategy = "first-parent"
+	// Combine the changes against each parent
+	MergeStrategyUnion MergeStrategy = "union"
+	// Diff against the best common ancestor of all parents
+	MergeStrategyMergeBase MergeStrategy = "merge-base"
+)
+
+type ParserOptions struct {
+	Filter          string        // Only process files matching this regular expression
+	Include         []string      // Only process files matching at least one of these globs
+	Exclude         []string      // Never process files matching any of these globs
+	RenameThreshold int           // The similarity threshold for renames, or 0 to disable rename detection
+	MergeStrategy   MergeStrategy // How merge commits are diffed, defaults to first-parent
+	// Diff the old and new commits of changed submodules, reporting the nested file paths
+	RecurseSubmodules bool
+}
+
+// Where and how a remote repository is cloned
+type RemoteOptions struct {
+	URL              string // The repository URL (ex: git@github.com:org/repo.git, https://github.com/org/repo.git, file:///srv/repo.git)
+	Ref              string // The branch or tag to clone, or the remote's default branch if empty
+	Depth            int    // The number of commits to fetch, or 0 for the full history
+	InMemory         bool   // Clone into memory instead of a temporary directory
+	SSHKeyFile       string // Private key file for SSH authentication
+	SSHKeyPassphrase string // Passphrase for the SSH private key
+	SSHAgent         bool   // Authenticate over SSH using the SSH agent
+	Username         string // Username for HTTPS token authentication, defaults to "git"
+	Token            string // Token (or password) for HTTPS authentication
+}
+
+// Where the keys trusted to sign deployed commits are read from
+type SignatureOptions struct {
+	Keyring        string // Path of an armored OpenPGP keyring in the repository
+	AllowedSigners string // Path of an SSH allowed signers file in the repository
+	Revision       string // The revision the keys are read from, or the from commit if empty
+}
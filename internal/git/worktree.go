@@ -0,0 +1,197 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// Diffs the uncommitted changes in the repository against HEAD and returns
+// a ChangeSet using the same filters as committed changes. When staged is
+// true, only the changes added to the index are diffed (git diff --cached),
+// otherwise the working tree is diffed, including staged, unstaged and
+// untracked files that are not ignored. Renames are not detected in the
+// working tree and are reported as a delete and a create.
+func (parser *GitParser) DiffWorktree(staged bool) (*ChangeSet, error) {
+
+	worktree, err := parser.repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWorktree, err)
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWorktree, err)
+	}
+
+	ignore, err := worktreeIgnorePatterns(worktree.Filesystem)
+	if err != nil {
+		return nil, err
+	}
+	filter := parser.pathFilter(ignore)
+
+	changeSet := NewEmptyChangeSet()
+	filtered := NewEmptyChangeSet()
+
+	for filePath, fileStatus := range status {
+
+		action, changed := worktreeAction(fileStatus)
+		if staged {
+			action, changed = stagedAction(fileStatus)
+		}
+		if !changed {
+			continue
+		}
+
+		target := changeSet
+		if !filter.Match(filePath) {
+			target = filtered
+		}
+
+		switch action {
+		case Insert:
+			target.Created = append(target.Created, filePath)
+		case Update:
+			target.Updated = append(target.Updated, filePath)
+		case Delete:
+			target.Deleted = append(target.Deleted, filePath)
+		}
+	}
+
+	for _, c := range []*ChangeSet{changeSet, filtered} {
+		sort.Strings(c.Created)
+		sort.Strings(c.Updated)
+		sort.Strings(c.Deleted)
+	}
+
+	parser.logger.Debugf("Diffed %d uncommitted changes against HEAD", changeSet.Len())
+
+	changeSet.Filtered = filtered
+	return changeSet, nil
+}
+
+// Returns the files in the working tree, or in the index when staged is
+// true, that match the filters.
+func (parser *GitParser) ListWorktreeFiles(staged bool) ([]string, error) {
+
+	worktree, err := parser.repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWorktree, err)
+	}
+
+	index, err := parser.repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWorktree, err)
+	}
+
+	files := make(map[string]bool, len(index.Entries))
+	for _, entry := range index.Entries {
+		files[entry.Name] = true
+	}
+
+	// Apply the unstaged deletes and untracked files
+	if !staged {
+		status, err := worktree.Status()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrWorktree, err)
+		}
+		for filePath, fileStatus := range status {
+			action, changed := worktreeAction(fileStatus)
+			switch {
+			case changed && action == Delete:
+				delete(files, filePath)
+			case changed && action == Insert:
+				files[filePath] = true
+			}
+		}
+	}
+
+	ignore, err := worktreeIgnorePatterns(worktree.Filesystem)
+	if err != nil {
+		return nil, err
+	}
+	filter := parser.pathFilter(ignore)
+
+	matches := make([]string, 0, len(files))
+	for filePath := range files {
+		if filter.Match(filePath) {
+			matches = append(matches, filePath)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// Returns the contents of a file as it exists in the working tree,
+// or in the index when staged is true.
+func (parser *GitParser) ReadWorktreeFile(filePath string, staged bool) ([]byte, error) {
+
+	if staged {
+		index, err := parser.repo.Storer.Index()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrWorktree, err)
+		}
+		entry, err := index.Entry(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("%s@index: %w", filePath, err)
+		}
+		blob, err := parser.repo.BlobObject(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("%s@index: %w", filePath, err)
+		}
+		reader, err := blob.Reader()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
+	worktree, err := parser.repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWorktree, err)
+	}
+	file, err := worktree.Filesystem.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// Returns the action for a file's index changes relative to HEAD,
+// and false if the file has no staged changes.
+func stagedAction(status *git.FileStatus) (ActionType, bool) {
+	switch status.Staging {
+	case git.Added:
+		return Insert, true
+	case git.Modified:
+		return Update, true
+	case git.Deleted:
+		return Delete, true
+	}
+	return 0, false
+}
+
+// Returns the action for a file's working tree changes relative to HEAD,
+// comparing whether the file exists in HEAD and in the working tree.
+// Returns false if the file is unchanged.
+func worktreeAction(status *git.FileStatus) (ActionType, bool) {
+	inHead := status.Staging != git.Added && status.Staging != git.Untracked
+	inWorktree := status.Worktree != git.Deleted &&
+		(status.Staging != git.Deleted || status.Worktree == git.Untracked)
+	switch {
+	case inHead && inWorktree:
+		if status.Staging == git.Unmodified && status.Worktree == git.Unmodified {
+			return 0, false
+		}
+		return Update, true
+	case inHead:
+		return Delete, true
+	case inWorktree:
+		return Insert, true
+	}
+	return 0, false
+}
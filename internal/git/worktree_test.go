@@ -0,0 +1,68 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a file to the working tree without staging it
+func (r *testRepo) edit(path, contents string) {
+	f, err := r.fs.Create(path)
+	assert.NoError(r.t, err)
+	_, err = f.Write([]byte(contents))
+	assert.NoError(r.t, err)
+	assert.NoError(r.t, f.Close())
+}
+
+func TestDiffWorktree(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	r.write("templates/web.template", template("Web"))
+	r.write("templates/app.template", template("App"))
+	r.write("README.md", "readme")
+	r.commit("initial")
+
+	r.edit("templates/vpc.template", template("Vpc")+"Outputs: {}\n")
+	r.write("templates/db.template", template("Db"))
+	r.remove("templates/web.template")
+	r.edit("templates/cache.template", template("Cache"))
+	r.write("templates/app.template", template("App")+"Outputs: {}\n")
+	r.edit("README.md", "changed")
+
+	parser := r.parser(&ParserOptions{Filter: "templates/.*"})
+
+	changeSet, err := parser.DiffWorktree(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/cache.template", "templates/db.template"}, changeSet.Created)
+	assert.Equal(t, []string{"templates/app.template", "templates/vpc.template"}, changeSet.Updated)
+	assert.Equal(t, []string{"templates/web.template"}, changeSet.Deleted)
+
+	changeSet, err = parser.DiffWorktree(true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/db.template"}, changeSet.Created)
+	assert.Equal(t, []string{"templates/app.template"}, changeSet.Updated)
+	assert.Equal(t, []string{"templates/web.template"}, changeSet.Deleted)
+}
+
+func TestReadWorktreeFile(t *testing.T) {
+	r := newTestRepo(t)
+	r.write("templates/vpc.template", template("Vpc"))
+	r.commit("initial")
+
+	r.write("templates/vpc.template", "staged")
+	r.edit("templates/vpc.template", "unstaged")
+
+	parser := r.parser(&ParserOptions{})
+
+	contents, err := parser.ReadWorktreeFile("templates/vpc.template", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "unstaged", string(contents))
+
+	contents, err = parser.ReadWorktreeFile("templates/vpc.template", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "staged", string(contents))
+
+	_, err = parser.ReadWorktreeFile("templates/missing.template", true)
+	assert.Error(t, err)
+}
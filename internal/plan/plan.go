@@ -0,0 +1,145 @@
+package plan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// The current plan file format version. Plans written with a different
+// version are rejected by Load.
+const Version = 1
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported plan version")
+	ErrChecksumMismatch   = errors.New("plan checksum mismatch")
+)
+
+type Plan struct {
+	Version                 int          `yaml:"version" json:"version"`
+	Commit                  string       `yaml:"commit" json:"commit"`
+	Ref                     string       `yaml:"ref,omitempty" json:"ref,omitempty"`
+	Uncommitted             bool         `yaml:"uncommitted,omitempty" json:"uncommitted,omitempty"`
+	Service                 string       `yaml:"service" json:"service"`
+	Environment             string       `yaml:"environment" json:"environment"`
+	Region                  string       `yaml:"region" json:"region"`
+	Profile                 string       `yaml:"profile" json:"profile"`
+	ProfilePrefix           string       `yaml:"profilePrefix" json:"profilePrefix"`
+	TemplateBucket          string       `yaml:"templateBucket,omitempty" json:"templateBucket,omitempty"`
+	TemplateBucketKeyPrefix string       `yaml:"templateBucketKeyPrefix,omitempty" json:"templateBucketKeyPrefix,omitempty"`
+	TemplateBucketKMSKeyId  string       `yaml:"templateBucketKmsKeyId,omitempty" json:"templateBucketKmsKeyId,omitempty"`
+	Created                 time.Time    `yaml:"created" json:"created"`
+	Operations              []*Operation `yaml:"operations" json:"operations"`
+	Checksum                string       `yaml:"checksum" json:"checksum"`
+}
+
+type Operation struct {
+	Layer           int               `yaml:"layer" json:"layer"`
+	Action          string            `yaml:"action" json:"action"`
+	FilePath        string            `yaml:"file" json:"file"`
+	StackName       string            `yaml:"stackName" json:"stackName"`
+	RenamedFrom     string            `yaml:"renamedFrom,omitempty" json:"renamedFrom,omitempty"`
+	TriggeredBy     string            `yaml:"triggeredBy,omitempty" json:"triggeredBy,omitempty"`
+	ParametersFile  string            `yaml:"parametersFile,omitempty" json:"parametersFile,omitempty"`
+	Parameters      map[string]string `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+	Capabilities    []string          `yaml:"capabilities,omitempty" json:"capabilities,omitempty"`
+	DisableRollback bool              `yaml:"disableRollback" json:"disableRollback"`
+}
+
+// Creates a new, empty plan for the given service
+func NewPlan(service string) *Plan {
+	return &Plan{
+		Version:    Version,
+		Service:    service,
+		Created:    time.Now().UTC(),
+		Operations: make([]*Operation, 0)}
+}
+
+// Loads a plan file from disk and verifies its version and checksum
+func Load(file string) (*Plan, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if err := p.Verify(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Seals the plan with a checksum and writes it to disk as JSON
+func (p *Plan) Save(file string) error {
+	if err := p.Seal(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// Computes the plan checksum and stores it in the plan
+func (p *Plan) Seal() error {
+	checksum, err := p.computeChecksum()
+	if err != nil {
+		return err
+	}
+	p.Checksum = checksum
+	return nil
+}
+
+// Verifies the plan version and that the plan contents have
+// not been modified since the plan was sealed.
+func (p *Plan) Verify() error {
+	if p.Version != Version {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, p.Version)
+	}
+	checksum, err := p.computeChecksum()
+	if err != nil {
+		return err
+	}
+	if checksum != p.Checksum {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, p.Checksum, checksum)
+	}
+	return nil
+}
+
+// Returns the plan operations grouped by layer, in execution order
+func (p *Plan) Layers() [][]*Operation {
+	indexes := make([]int, 0)
+	byLayer := make(map[int][]*Operation)
+	for _, op := range p.Operations {
+		if _, ok := byLayer[op.Layer]; !ok {
+			indexes = append(indexes, op.Layer)
+		}
+		byLayer[op.Layer] = append(byLayer[op.Layer], op)
+	}
+	sort.Ints(indexes)
+	layers := make([][]*Operation, len(indexes))
+	for i, index := range indexes {
+		layers[i] = byLayer[index]
+	}
+	return layers
+}
+
+// Returns the SHA-256 checksum of the plan, excluding the checksum field
+func (p *Plan) computeChecksum() (string, error) {
+	unsealed := *p
+	unsealed.Checksum = ""
+	data, err := json.Marshal(&unsealed)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,66 @@
+package plan
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPlan() *Plan {
+	p := NewPlan("cloudformation")
+	p.Commit = "3b0b787e0c5929e20a9c69521eb5aad5fad4e9a7"
+	p.Environment = "nonprod"
+	p.Operations = append(p.Operations,
+		&Operation{Layer: 1, Action: "update", FilePath: "templates/web.template", StackName: "web"},
+		&Operation{Layer: 0, Action: "create", FilePath: "templates/vpc.template", StackName: "vpc",
+			Parameters: map[string]string{"Environment": "nonprod"}},
+		&Operation{Layer: 2, Action: "delete", FilePath: "templates/old.template", StackName: "old"})
+	return p
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "plan.json")
+
+	p := testPlan()
+	assert.NoError(t, p.Save(file))
+	assert.NotEmpty(t, p.Checksum)
+
+	loaded, err := Load(file)
+	assert.NoError(t, err)
+	assert.Equal(t, p.Checksum, loaded.Checksum)
+	assert.Equal(t, p.Commit, loaded.Commit)
+	assert.Len(t, loaded.Operations, 3)
+	assert.Equal(t, "nonprod", loaded.Operations[1].Parameters["Environment"])
+}
+
+func TestLoadRejectsModifiedPlan(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "plan.json")
+
+	assert.NoError(t, testPlan().Save(file))
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	tampered := strings.Replace(string(data), `"stackName": "web"`, `"stackName": "web2"`, 1)
+	assert.NoError(t, os.WriteFile(file, []byte(tampered), 0644))
+
+	_, err = Load(file)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+}
+
+func TestVerifyRejectsUnsupportedVersion(t *testing.T) {
+	p := testPlan()
+	p.Version = Version + 1
+	assert.NoError(t, p.Seal())
+	assert.ErrorIs(t, p.Verify(), ErrUnsupportedVersion)
+}
+
+func TestLayers(t *testing.T) {
+	layers := testPlan().Layers()
+	assert.Len(t, layers, 3)
+	assert.Equal(t, "vpc", layers[0][0].StackName)
+	assert.Equal(t, "web", layers[1][0].StackName)
+	assert.Equal(t, "old", layers[2][0].StackName)
+}
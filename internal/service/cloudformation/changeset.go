@@ -0,0 +1,234 @@
+package cloudformation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	"github.com/jeremyhahn/gitformation/internal/git"
+	"github.com/jeremyhahn/gitformation/internal/plan"
+)
+
+// Returned by describeChangeSet when a change set failed because the
+// template and parameters match the deployed stack.
+var errNoChanges = errors.New("change set contains no changes")
+
+// Resource types that hold state which is lost when the
+// resource is replaced or removed.
+var statefulResourceTypes = map[string]bool{
+	"AWS::DynamoDB::Table":               true,
+	"AWS::DynamoDB::GlobalTable":         true,
+	"AWS::EC2::Volume":                   true,
+	"AWS::EFS::FileSystem":               true,
+	"AWS::ElastiCache::CacheCluster":     true,
+	"AWS::ElastiCache::ReplicationGroup": true,
+	"AWS::Elasticsearch::Domain":         true,
+	"AWS::OpenSearchService::Domain":     true,
+	"AWS::Kinesis::Stream":               true,
+	"AWS::KMS::Key":                      true,
+	"AWS::Logs::LogGroup":                true,
+	"AWS::RDS::DBCluster":                true,
+	"AWS::RDS::DBInstance":               true,
+	"AWS::Redshift::Cluster":             true,
+	"AWS::S3::Bucket":                    true,
+	"AWS::SQS::Queue":                    true,
+	"AWS::SecretsManager::Secret":        true,
+}
+
+// Creates or updates a stack using a change set. The resource level
+// changes are passed to the ReviewChangeSet hook and the change set is only
+// executed if the changes are approved.
+func (cfn *CloudFormationService) executeChangeSet(
+	serviceParams *executor.ServiceParams,
+	changeSetType types.ChangeSetType) {
+
+	op := serviceParams.Operation
+
+	params, err := cfn.createChangeSetParams(op, changeSetType)
+	if err != nil {
+		cfn.sendError(serviceParams, err)
+		return
+	}
+	cfn.logger.Debugf("Creating %s change set %s for cloudformation stack: %s",
+		changeSetType, *params.ChangeSetName, op.StackName)
+
+	if cfn.options.DryRun {
+		cfn.sendDryRun(serviceParams, "create-change-set", params)
+		return
+	}
+
+	action := "update"
+	if changeSetType == types.ChangeSetTypeCreate {
+		action = "create"
+	}
+	sendError := func(err error) {
+		cfn.sendError(serviceParams, &StackOperationError{
+			Action:    action,
+			StackName: op.StackName,
+			Err:       err})
+	}
+
+	result, err := cfn.client.CreateChangeSet(context.TODO(), params)
+	if err != nil {
+		sendError(err)
+		return
+	}
+
+	changes, err := cfn.describeChangeSet(op, result.Id)
+	if errors.Is(err, errNoChanges) && changeSetType == types.ChangeSetTypeUpdate {
+		cfn.deleteChangeSet(op, result.Id, changeSetType)
+		cfn.sendUnchanged(serviceParams)
+		return
+	}
+	if err != nil {
+		sendError(err)
+		return
+	}
+
+	if cfn.options.ReviewChangeSet != nil && !cfn.options.ReviewChangeSet(changes) {
+		cfn.logger.Infof("change set %s for stack %s was not approved, deleting change set",
+			*params.ChangeSetName, op.StackName)
+		cfn.deleteChangeSet(op, result.Id, changeSetType)
+		sendError(fmt.Errorf("change set %s for stack %s was not approved",
+			*params.ChangeSetName, op.StackName))
+		return
+	}
+
+	_, err = cfn.client.ExecuteChangeSet(context.TODO(), &cloudformation.ExecuteChangeSetInput{
+		ChangeSetName:   result.Id,
+		DisableRollback: &op.DisableRollback})
+	if err != nil {
+		sendError(err)
+		return
+	}
+
+	actionType := git.Update
+	if changeSetType == types.ChangeSetTypeCreate {
+		actionType = git.Insert
+	}
+	cfn.sendResponse(serviceParams, actionType, *result.StackId)
+}
+
+// create-change-set params
+func (cfn *CloudFormationService) createChangeSetParams(
+	op *plan.Operation,
+	changeSetType types.ChangeSetType) (*cloudformation.CreateChangeSetInput, error) {
+
+	changeSetName := fmt.Sprintf("gitformation-%d", time.Now().Unix())
+
+	capabilities, err := stackCapabilities(op)
+	if err != nil {
+		return nil, err
+	}
+
+	changeSetParams := &cloudformation.CreateChangeSetInput{
+		StackName:     &op.StackName,
+		ChangeSetName: &changeSetName,
+		ChangeSetType: changeSetType,
+		Parameters:    cfn.stackParameters(op),
+		Capabilities:  capabilities}
+
+	body, url, err := cfn.templateLocation(op)
+	if err != nil {
+		return nil, err
+	}
+	changeSetParams.TemplateBody = body
+	changeSetParams.TemplateURL = url
+
+	return changeSetParams, nil
+}
+
+// Waits for a change set to finish creating and returns the
+// resource level changes it contains.
+func (cfn *CloudFormationService) describeChangeSet(
+	op *plan.Operation,
+	changeSetId *string) (*executor.StackChanges, error) {
+
+	stackChanges := &executor.StackChanges{
+		FilePath:  op.FilePath,
+		StackName: op.StackName,
+		Changes:   make([]*executor.ResourceChange, 0)}
+
+	var nextToken *string
+	for {
+		result, err := cfn.client.DescribeChangeSet(context.TODO(), &cloudformation.DescribeChangeSetInput{
+			ChangeSetName: changeSetId,
+			NextToken:     nextToken})
+		if err != nil {
+			return nil, err
+		}
+
+		switch result.Status {
+		case types.ChangeSetStatusCreatePending, types.ChangeSetStatusCreateInProgress:
+			time.Sleep(5 * time.Second)
+			continue
+		case types.ChangeSetStatusFailed:
+			if isNoChangesReason(aws.ToString(result.StatusReason)) {
+				return nil, errNoChanges
+			}
+			return nil, fmt.Errorf("change set %s for stack %s failed: %s",
+				aws.ToString(result.ChangeSetName), op.StackName, aws.ToString(result.StatusReason))
+		}
+
+		stackChanges.ChangeSetName = aws.ToString(result.ChangeSetName)
+		for _, change := range result.Changes {
+			if change.ResourceChange == nil {
+				continue
+			}
+			rc := change.ResourceChange
+			scope := make([]string, len(rc.Scope))
+			for i, attribute := range rc.Scope {
+				scope[i] = string(attribute)
+			}
+			stackChanges.Changes = append(stackChanges.Changes, &executor.ResourceChange{
+				Action:       string(rc.Action),
+				LogicalId:    aws.ToString(rc.LogicalResourceId),
+				PhysicalId:   aws.ToString(rc.PhysicalResourceId),
+				ResourceType: aws.ToString(rc.ResourceType),
+				Replacement:  string(rc.Replacement),
+				Scope:        scope,
+				Stateful:     statefulResourceTypes[aws.ToString(rc.ResourceType)]})
+		}
+
+		if result.NextToken == nil {
+			return stackChanges, nil
+		}
+		nextToken = result.NextToken
+	}
+}
+
+// Returns true if a change set status reason reports that the
+// submitted template and parameters did not contain any changes.
+func isNoChangesReason(reason string) bool {
+	return strings.Contains(reason, "didn't contain changes") ||
+		strings.Contains(reason, "No updates are to be performed")
+}
+
+// Deletes a change set that was not approved or has no changes. Rejected CREATE change sets
+// leave an empty stack in REVIEW_IN_PROGRESS, which is deleted as well.
+func (cfn *CloudFormationService) deleteChangeSet(
+	op *plan.Operation,
+	changeSetId *string,
+	changeSetType types.ChangeSetType) {
+
+	_, err := cfn.client.DeleteChangeSet(context.TODO(), &cloudformation.DeleteChangeSetInput{
+		ChangeSetName: changeSetId})
+	if err != nil {
+		cfn.logger.Error(err)
+	}
+
+	if changeSetType == types.ChangeSetTypeCreate {
+		_, err = cfn.client.DeleteStack(context.TODO(), &cloudformation.DeleteStackInput{
+			StackName: &op.StackName})
+		if err != nil {
+			cfn.logger.Error(err)
+		}
+	}
+}
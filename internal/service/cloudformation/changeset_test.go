@@ -0,0 +1,92 @@
+package cloudformation
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	"github.com/jeremyhahn/gitformation/internal/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+// A describe-change-set resource change
+const (
+	modifyDatabase = `<member><Type>Resource</Type><ResourceChange>` +
+		`<Action>Modify</Action><LogicalResourceId>Database</LogicalResourceId>` +
+		`<PhysicalResourceId>db-1</PhysicalResourceId><ResourceType>AWS::RDS::DBInstance</ResourceType>` +
+		`<Replacement>True</Replacement><Scope><member>Properties</member><member>Tags</member></Scope>` +
+		`</ResourceChange></member>`
+	addTopic = `<member><Type>Resource</Type><ResourceChange>` +
+		`<Action>Add</Action><LogicalResourceId>Topic</LogicalResourceId>` +
+		`<ResourceType>AWS::SNS::Topic</ResourceType></ResourceChange></member>`
+)
+
+func TestDescribeChangeSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		pages   map[string]string // describe-change-set results by NextToken
+		changes []*executor.ResourceChange
+		err     string
+	}{
+		{
+			name: "maps resource changes",
+			pages: map[string]string{
+				"": `<ChangeSetName>gitformation-1</ChangeSetName><Status>CREATE_COMPLETE</Status>` +
+					`<Changes>` + modifyDatabase + addTopic + `</Changes>`},
+			changes: []*executor.ResourceChange{
+				{Action: "Modify", LogicalId: "Database", PhysicalId: "db-1", ResourceType: "AWS::RDS::DBInstance",
+					Replacement: "True", Scope: []string{"Properties", "Tags"}, Stateful: true},
+				{Action: "Add", LogicalId: "Topic", ResourceType: "AWS::SNS::Topic", Scope: []string{}}},
+		},
+		{
+			name: "follows pages",
+			pages: map[string]string{
+				"": `<ChangeSetName>gitformation-1</ChangeSetName><Status>CREATE_COMPLETE</Status>` +
+					`<Changes>` + modifyDatabase + `</Changes><NextToken>page-2</NextToken>`,
+				"page-2": `<ChangeSetName>gitformation-1</ChangeSetName><Status>CREATE_COMPLETE</Status>` +
+					`<Changes>` + addTopic + `</Changes>`},
+			changes: []*executor.ResourceChange{
+				{Action: "Modify", LogicalId: "Database", PhysicalId: "db-1", ResourceType: "AWS::RDS::DBInstance",
+					Replacement: "True", Scope: []string{"Properties", "Tags"}, Stateful: true},
+				{Action: "Add", LogicalId: "Topic", ResourceType: "AWS::SNS::Topic", Scope: []string{}}},
+		},
+		{
+			name: "detects no changes",
+			pages: map[string]string{
+				"": `<ChangeSetName>gitformation-1</ChangeSetName><Status>FAILED</Status>` +
+					`<StatusReason>The submitted information didn't contain changes. ` +
+					`Submit different information to create a change set.</StatusReason>`},
+			err: errNoChanges.Error(),
+		},
+		{
+			name: "reports failures",
+			pages: map[string]string{
+				"": `<ChangeSetName>gitformation-1</ChangeSetName><Status>FAILED</Status>` +
+					`<StatusReason>Template format error</StatusReason>`},
+			err: "change set gitformation-1 for stack vpc failed: Template format error",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfn := newStubService(t, func(action string, form url.Values) string {
+				assert.Equal(t, "DescribeChangeSet", action)
+				return test.pages[form.Get("NextToken")]
+			})
+
+			changes, err := cfn.describeChangeSet(
+				&plan.Operation{FilePath: "templates/vpc.template", StackName: "vpc"},
+				aws.String("arn:changeset"))
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "gitformation-1", changes.ChangeSetName)
+			assert.Equal(t, "vpc", changes.StackName)
+			assert.Equal(t, "templates/vpc.template", changes.FilePath)
+			assert.Equal(t, test.changes, changes.Changes)
+		})
+	}
+}
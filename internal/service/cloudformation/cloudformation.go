@@ -4,33 +4,37 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"sort"
 	"strings"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/op/go-logging"
+	"golang.org/x/exp/maps"
 	"gopkg.in/yaml.v3"
 
 	"github.com/jeremyhahn/gitformation/internal/executor"
+	"github.com/jeremyhahn/gitformation/internal/git"
+	"github.com/jeremyhahn/gitformation/internal/plan"
 )
 
 type CloudFormationService struct {
 	name         string
 	logger       *logging.Logger
 	client       *cloudformation.Client
+	s3Client     *s3.Client
 	options      *ServiceOptions
 	Mappings     map[string]string // Template mappings
+	StackNames   map[string]string // Template stack names
 	Dependencies [][]string        // Template dependencies
 	executor.ServiceExecutor
 }
 
 func NewCloudFormationService(logger *logging.Logger,
-	options *ServiceOptions) executor.ServiceExecutor {
+	options *ServiceOptions) (executor.ServiceExecutor, error) {
 
 	logger.Debug("Creating new CloudFormation service")
 
@@ -48,21 +52,30 @@ func NewCloudFormationService(logger *logging.Logger,
 			config.WithRegion(options.Region))
 	}
 	if err != nil {
-		logger.Fatalf("unable to load AWS SDK config: %v", err)
+		return nil, fmt.Errorf("%w: %w", ErrConfig, err)
 	}
 
 	cfn := &CloudFormationService{
 		name:         "cloudformation",
 		logger:       logger,
 		client:       cloudformation.NewFromConfig(cfg),
+		s3Client:     newS3Client(cfg, options.Bucket),
 		options:      options,
 		Mappings:     make(map[string]string, 0),
+		StackNames:   make(map[string]string, 0),
 		Dependencies: make([][]string, 0)}
 
-	cfn.loadParameterMappings(options.ParameterFileMappings)
-	cfn.loadDependencies(options.DependencyGraph)
+	if err := cfn.loadParameterMappings(options.ParameterFileMappings); err != nil {
+		return nil, err
+	}
+	if err := cfn.loadStackNames(options.StackNameMappings); err != nil {
+		return nil, err
+	}
+	if err := cfn.loadDependencies(options.DependencyGraph); err != nil {
+		return nil, err
+	}
 
-	return cfn
+	return cfn, nil
 }
 
 // Returns the service name
@@ -75,53 +88,34 @@ func (cfn *CloudFormationService) Create(serviceParams *executor.ServiceParams)
 
 	defer serviceParams.WaitGroup.Done()
 
-	params := cfn.createStackParams(serviceParams.FilePath)
+	if cfn.options.ChangeSetCreates {
+		cfn.executeChangeSet(serviceParams, types.ChangeSetTypeCreate)
+		return
+	}
+
+	params, err := cfn.createStackParams(serviceParams.Operation)
+	if err != nil {
+		cfn.sendError(serviceParams, err)
+		return
+	}
 	cfn.logger.Debugf("Creating cloudformation stack: %s", *params.StackName)
 
 	if cfn.options.DryRun {
-		cfn.logger.Fatalf("create-stack params: %+v", params)
+		cfn.sendDryRun(serviceParams, "create-stack", params)
+		return
 	}
 
 	result, err := cfn.client.CreateStack(context.TODO(), params)
 	if err != nil {
-		if cfn.options.ExitOnError {
-			cfn.logger.Fatal(err)
-		}
-		response := make(map[string]error, 1)
-		response[serviceParams.FilePath] = err
-		serviceParams.ErrorChan <- response
-		//cfn.logger.Errorf("cloudformation service: %s", err)
+		cfn.sendError(serviceParams, &StackOperationError{
+			Action:    "create",
+			StackName: *params.StackName,
+			Err:       err})
 		return
 	}
 
-	if cfn.options.WaitForStackResult {
-		for {
-			dsResult, err := cfn.client.DescribeStacks(context.TODO(), &cloudformation.DescribeStacksInput{StackName: params.StackName})
-			if err != nil {
-				if cfn.options.ExitOnError {
-					cfn.logger.Fatal(err)
-				}
-			}
-			if len(dsResult.Stacks) == 0 {
-				if cfn.options.ExitOnError {
-					cfn.logger.Fatal("unexpected response from describe-stacks: stacks.length = 0")
-				}
-			}
-			if strings.Contains(string(dsResult.Stacks[0].StackStatus), "FAILED") {
-				cfn.logger.Fatal("%s", dsResult.Stacks[0].StackStatus)
-			}
-			if strings.Contains(string(dsResult.Stacks[0].StackStatus), "COMPLETE") {
-				cfn.logger.Fatal("%s", dsResult.Stacks[0].StackStatus)
-				break
-			}
-			time.Sleep(5 * time.Second)
-		}
-	}
-
 	cfn.logger.Debugf("%+v", result)
-	stackInfo := make(map[string]string, 1)
-	stackInfo[serviceParams.FilePath] = *result.StackId //fmt.Sprintf("%+v", result.ResultMetadata)
-	serviceParams.ResponseChan <- stackInfo
+	cfn.sendResponse(serviceParams, git.Insert, *result.StackId)
 }
 
 // Updates an existing cloudformation stack
@@ -129,62 +123,144 @@ func (cfn *CloudFormationService) Update(serviceParams *executor.ServiceParams)
 
 	defer serviceParams.WaitGroup.Done()
 
-	params := cfn.updateStackParams(serviceParams.FilePath)
+	if cfn.options.UseChangeSets {
+		cfn.executeChangeSet(serviceParams, types.ChangeSetTypeUpdate)
+		return
+	}
+
+	params, err := cfn.updateStackParams(serviceParams.Operation)
+	if err != nil {
+		cfn.sendError(serviceParams, err)
+		return
+	}
 	cfn.logger.Debugf("Updating cloudformation stack: %+v", *params.StackName)
 
 	if cfn.options.DryRun {
-		cfn.logger.Fatalf("update-stack params: %+v", params)
+		cfn.sendDryRun(serviceParams, "update-stack", params)
+		return
 	}
 
 	result, err := cfn.client.UpdateStack(context.TODO(), params)
+	if isNoUpdates(err) {
+		cfn.sendUnchanged(serviceParams)
+		return
+	}
 	if err != nil {
-		response := make(map[string]error, 1)
-		response[serviceParams.FilePath] = err
-		serviceParams.ErrorChan <- response
-		if cfn.options.ExitOnError {
-			cfn.logger.Fatal(err)
-		}
-		cfn.logger.Error(err)
+		cfn.sendError(serviceParams, &StackOperationError{
+			Action:    "update",
+			StackName: *params.StackName,
+			Err:       err})
 		return
 	}
+
 	cfn.logger.Debugf("%+v", result)
-	stackInfo := make(map[string]string, 1)
-	stackInfo[*result.StackId] = fmt.Sprintf("%+v", result.ResultMetadata)
-	serviceParams.ResponseChan <- stackInfo
+	cfn.sendResponse(serviceParams, git.Update, *result.StackId)
 }
 
 // Deletes an existing cloudformation stack
 func (cfn *CloudFormationService) Delete(serviceParams *executor.ServiceParams) {
 
 	defer serviceParams.WaitGroup.Done()
-	params := cfn.deleteStackParams(serviceParams.FilePath)
+	params := cfn.deleteStackParams(serviceParams.Operation)
 	cfn.logger.Debugf("Deleting cloudformation stack: %s", *params.StackName)
 
 	if cfn.options.DryRun {
-		cfn.logger.Fatalf("delete-stack params: %+v", params)
+		cfn.sendDryRun(serviceParams, "delete-stack", params)
+		return
 	}
 
 	result, err := cfn.client.DeleteStack(context.TODO(), params)
 	if err != nil {
-		response := make(map[string]error, 1)
-		response[serviceParams.FilePath] = err
-		serviceParams.ErrorChan <- response
-		if cfn.options.ExitOnError {
-			cfn.logger.Fatal(err)
-		}
-		cfn.logger.Error(err)
+		cfn.sendError(serviceParams, &StackOperationError{
+			Action:    "delete",
+			StackName: *params.StackName,
+			Err:       err})
 		return
 	}
+
 	cfn.logger.Debugf("%+v", result)
-	stackInfo := make(map[string]string, 1)
-	stackInfo[serviceParams.FilePath] = "success" // fmt.Sprintf("%+v", result.ResultMetadata); json.Marshal has problems with this
-	serviceParams.ResponseChan <- stackInfo
+	cfn.sendResponse(serviceParams, git.Delete, "")
+}
+
+// Reports a failed operation to the executor
+func (cfn *CloudFormationService) sendError(serviceParams *executor.ServiceParams, err error) {
+	response := make(map[string]error, 1)
+	response[serviceParams.Operation.FilePath] = err
+	serviceParams.ErrorChan <- response
+}
+
+// Reports a stack that is already up to date to the executor
+func (cfn *CloudFormationService) sendUnchanged(serviceParams *executor.ServiceParams) {
+	op := serviceParams.Operation
+	cfn.logger.Infof("No updates are to be performed on stack %s", op.StackName)
+	serviceParams.ResponseChan <- &executor.OperationResponse{
+		FilePath:  op.FilePath,
+		StackName: op.StackName,
+		Unchanged: true}
+}
+
+// Logs the API request that would have been sent and reports the
+// operation to the executor without calling CloudFormation.
+func (cfn *CloudFormationService) sendDryRun(
+	serviceParams *executor.ServiceParams,
+	apiCall string,
+	params any) {
+
+	op := serviceParams.Operation
+	data, err := json.Marshal(params)
+	if err != nil {
+		cfn.sendError(serviceParams, err)
+		return
+	}
+	cfn.logger.Infof("[dry-run] %s params: %s", apiCall, data)
+	serviceParams.ResponseChan <- &executor.OperationResponse{
+		FilePath:  op.FilePath,
+		StackName: op.StackName,
+		Status:    dryRunStatus}
 }
 
-// Returns a feasible cloudformation stack name, given a file name
+// Groups the passed template files into dependency layers using the
+// --dependency-graph. Stacks within a layer do not depend on each other
+// and may be executed in parallel. Stacks that do not appear in the graph
+// have no known dependencies and are placed in the first layer. Empty
+// layers are omitted.
+func (cfn *CloudFormationService) ExecutionLayers(files []string) [][]string {
+
+	layerIndex := make(map[string]int)
+	for i, layer := range cfn.Dependencies {
+		for _, node := range layer {
+			layerIndex[cfn.cleanStackName(node)] = i
+		}
+	}
+
+	layers := make([][]string, max(len(cfn.Dependencies), 1))
+	for _, file := range files {
+		i := layerIndex[*cfn.parseStackNameFromFile(file)]
+		layers[i] = append(layers[i], file)
+	}
+
+	nonEmpty := make([][]string, 0, len(layers))
+	for _, layer := range layers {
+		if len(layer) > 0 {
+			nonEmpty = append(nonEmpty, layer)
+		}
+	}
+	return nonEmpty
+}
+
+// Returns the name of the stack deployed from a template file
+func (cfn *CloudFormationService) StackName(filePath string) string {
+	return *cfn.parseStackNameFromFile(filePath)
+}
+
+// Returns a feasible cloudformation stack name, given a file name. Files
+// listed in the --stack-names mappings use the mapped stack name.
 func (cfn *CloudFormationService) parseStackNameFromFile(file string) *string {
 
-	var stackName string
+	stackName, ok := cfn.StackNames[file]
+	if ok {
+		return &stackName
+	}
 
 	pathPieces := strings.Split(file, "/")
 	fileName := pathPieces[len(pathPieces)-1]
@@ -206,162 +282,163 @@ func (Cfn *CloudFormationService) cleanStackName(raw string) string {
 	return s
 }
 
-// create-stack params
-func (cfn *CloudFormationService) createStackParams(filePath string) *cloudformation.CreateStackInput {
+// Resolves the stack name, parameters, and capabilities for an
+// operation on a template file.
+func (cfn *CloudFormationService) PlanOperation(actionType git.ActionType, filePath string) (*plan.Operation, error) {
 
-	stackInputParams := &cloudformation.CreateStackInput{
-		StackName:       cfn.parseStackNameFromFile(filePath),
-		DisableRollback: &cfn.options.DisableRollback}
-
-	// Use --template-url if deployment bucket is defined
-	if cfn.options.Bucket != nil {
-		templateUrl := fmt.Sprintf("https://%s.s3.amazonaws.com/%s/%s",
-			cfn.options.Bucket.BucketName,
-			cfn.options.Bucket.KeyPrefix,
-			filePath)
-		stackInputParams.TemplateURL = &templateUrl
-	} else {
-		stackInputParams.TemplateBody = &filePath
+	op := &plan.Operation{
+		Action:    actionType.String(),
+		FilePath:  filePath,
+		StackName: *cfn.parseStackNameFromFile(filePath)}
+
+	if actionType == git.Delete {
+		return op, nil
 	}
 
+	op.DisableRollback = cfn.options.DisableRollback
+
 	// Pass --parameters if defined
 	if len(cfn.options.Parameters) > 0 {
-		params := make([]types.Parameter, len(cfn.options.Parameters))
-		i := 0
+		op.Parameters = make(map[string]string, len(cfn.options.Parameters))
 		for k, v := range cfn.options.Parameters {
-			params[i] = types.Parameter{
-				ParameterKey:   &k,
-				ParameterValue: &v}
-			i++
+			op.Parameters[k] = v
 		}
-		stackInputParams.Parameters = params
 	}
 
 	// Load parameters from --parameter-files location if specified
 	parametersFile := cfn.parametersFromFile(filePath)
 	if parametersFile != nil {
-		parameters := cfn.parseParametersFile(*parametersFile)
+		parameters, err := cfn.parseParametersFile(*parametersFile)
+		if err != nil {
+			return nil, err
+		}
 		if len(parameters) > 0 {
 			cfn.logger.Infof("using parameters file: %s", *parametersFile)
-			stackInputParams.Parameters = parameters
+			op.ParametersFile = *parametersFile
+			op.Parameters = parameters
 		}
 	}
 
 	// Pass --capabilities if defined
 	if len(cfn.options.Capabilities) > 0 {
-		capabilities := make([]types.Capability, len(cfn.options.Capabilities))
-		i := 0
-		for _, capabilitiy := range cfn.options.Capabilities {
-			switch capabilitiy {
-			case "CAPABILITY_IAM":
-				capabilities[i] = types.CapabilityCapabilityIam
-			case "CAPABILITY_NAMED_IAM":
-				capabilities[i] = types.CapabilityCapabilityNamedIam
-			case "CAPABILITY_AUTO_EXPAND":
-				capabilities[i] = types.CapabilityCapabilityAutoExpand
-			default:
-				cfn.logger.Fatal("invalid capability: %s", capabilitiy)
-			}
-			i++
+		op.Capabilities = make([]string, len(cfn.options.Capabilities))
+		copy(op.Capabilities, cfn.options.Capabilities)
+		if _, err := stackCapabilities(op); err != nil {
+			return nil, err
 		}
-		stackInputParams.Capabilities = capabilities
 	}
 
-	return stackInputParams
+	return op, nil
 }
 
-// update-stack params
-func (cfn *CloudFormationService) updateStackParams(filePath string) *cloudformation.UpdateStackInput {
+// create-stack params
+func (cfn *CloudFormationService) createStackParams(op *plan.Operation) (*cloudformation.CreateStackInput, error) {
 
-	stackUpdateParams := &cloudformation.UpdateStackInput{
-		StackName:       cfn.parseStackNameFromFile(filePath),
-		DisableRollback: &cfn.options.DisableRollback}
-
-	// Use --template-url if deployment bucket is defined
-	if cfn.options.Bucket != nil {
-		templateUrl := fmt.Sprintf("https://%s.s3.amazonaws.com/%s/%s",
-			cfn.options.Bucket.BucketName,
-			cfn.options.Bucket.KeyPrefix,
-			filePath)
-		stackUpdateParams.TemplateURL = &templateUrl
-	} else {
-		stackUpdateParams.TemplateBody = &filePath
+	capabilities, err := stackCapabilities(op)
+	if err != nil {
+		return nil, err
 	}
 
-	// Pass --parameters if defined
-	if len(cfn.options.Parameters) > 0 {
-		params := make([]types.Parameter, len(cfn.options.Parameters))
-		i := 0
-		for k, v := range cfn.options.Parameters {
-			params[i] = types.Parameter{
-				ParameterKey:   &k,
-				ParameterValue: &v}
-			i++
-		}
-		stackUpdateParams.Parameters = params
+	stackInputParams := &cloudformation.CreateStackInput{
+		StackName:       &op.StackName,
+		DisableRollback: &op.DisableRollback,
+		Parameters:      cfn.stackParameters(op),
+		Capabilities:    capabilities}
+
+	body, url, err := cfn.templateLocation(op)
+	if err != nil {
+		return nil, err
 	}
+	stackInputParams.TemplateBody = body
+	stackInputParams.TemplateURL = url
 
-	// Load parameters from --parameter-files location if specified
-	parametersFile := cfn.parametersFromFile(filePath)
-	if parametersFile != nil {
-		parameters := cfn.parseParametersFile(*parametersFile)
-		if len(parameters) > 0 {
-			cfn.logger.Infof("using parameters file: %s", *parametersFile)
-			stackUpdateParams.Parameters = parameters
-		}
+	return stackInputParams, nil
+}
+
+// update-stack params
+func (cfn *CloudFormationService) updateStackParams(op *plan.Operation) (*cloudformation.UpdateStackInput, error) {
+
+	capabilities, err := stackCapabilities(op)
+	if err != nil {
+		return nil, err
 	}
 
-	// Pass --capabilities if defined
-	if len(cfn.options.Capabilities) > 0 {
-		capabilities := make([]types.Capability, len(cfn.options.Capabilities))
-		i := 0
-		for _, capabilitiy := range cfn.options.Capabilities {
-			switch capabilitiy {
-			case "CAPABILITY_IAM":
-				capabilities[i] = types.CapabilityCapabilityIam
-			case "CAPABILITY_NAMED_IAM":
-				capabilities[i] = types.CapabilityCapabilityNamedIam
-			case "CAPABILITY_AUTO_EXPAND":
-				capabilities[i] = types.CapabilityCapabilityAutoExpand
-			default:
-				cfn.logger.Fatal("invalid capability: %s", capabilitiy)
-			}
-			i++
-		}
-		stackUpdateParams.Capabilities = capabilities
+	stackUpdateParams := &cloudformation.UpdateStackInput{
+		StackName:       &op.StackName,
+		DisableRollback: &op.DisableRollback,
+		Parameters:      cfn.stackParameters(op),
+		Capabilities:    capabilities}
+
+	body, url, err := cfn.templateLocation(op)
+	if err != nil {
+		return nil, err
 	}
+	stackUpdateParams.TemplateBody = body
+	stackUpdateParams.TemplateURL = url
 
-	return stackUpdateParams
+	return stackUpdateParams, nil
 }
 
 // delete-stack params
-func (cfn *CloudFormationService) deleteStackParams(filePath string) *cloudformation.DeleteStackInput {
+func (cfn *CloudFormationService) deleteStackParams(op *plan.Operation) *cloudformation.DeleteStackInput {
 	return &cloudformation.DeleteStackInput{
-		StackName: cfn.parseStackNameFromFile(filePath)}
+		StackName: &op.StackName}
+}
+
+// Converts the planned parameters to cloudformation parameters, sorted by key
+func (cfn *CloudFormationService) stackParameters(op *plan.Operation) []types.Parameter {
+	if len(op.Parameters) == 0 {
+		return nil
+	}
+	keys := maps.Keys(op.Parameters)
+	sort.Strings(keys)
+	params := make([]types.Parameter, len(keys))
+	for i, k := range keys {
+		params[i] = types.Parameter{
+			ParameterKey:   aws.String(k),
+			ParameterValue: aws.String(op.Parameters[k])}
+	}
+	return params
+}
+
+// Converts the planned capabilities to cloudformation capabilities
+func stackCapabilities(op *plan.Operation) ([]types.Capability, error) {
+	if len(op.Capabilities) == 0 {
+		return nil, nil
+	}
+	capabilities := make([]types.Capability, len(op.Capabilities))
+	for i, capabilitiy := range op.Capabilities {
+		switch capabilitiy {
+		case "CAPABILITY_IAM":
+			capabilities[i] = types.CapabilityCapabilityIam
+		case "CAPABILITY_NAMED_IAM":
+			capabilities[i] = types.CapabilityCapabilityNamedIam
+		case "CAPABILITY_AUTO_EXPAND":
+			capabilities[i] = types.CapabilityCapabilityAutoExpand
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCapability, capabilitiy)
+		}
+	}
+	return capabilities, nil
 }
 
 // Check to see if a parameter file exists at --parameter-files
 func (cfn *CloudFormationService) parametersFromFile(filePath string) *string {
-	file := filepath.Base(filePath)
-	fileNameNoExt := strings.Split(file, ".")[0]
-	parameterFile := fmt.Sprintf("%s/%s/%s.parameters", cfn.options.ParameterFiles,
-		cfn.options.Environment, fileNameNoExt)
-	if _, err := os.Stat(parameterFile); err == nil {
+	parameterFile := cfn.parametersPath(filePath)
+	if _, err := cfn.readFile(parameterFile); err == nil {
 		return &parameterFile
 	}
 	return nil
 }
 
-// Parses a parameters file and returns all of the parameters in a format suitable
-// for create-stack and update-stack operations.
-func (cfn *CloudFormationService) parseParametersFile(file string) []types.Parameter {
+// Parses a parameters file and returns all of the parameters as a map of
+// parameter keys to values, suitable for create-stack and update-stack
+// operations.
+func (cfn *CloudFormationService) parseParametersFile(file string) (map[string]string, error) {
 
-	data, err := os.ReadFile(file)
+	data, err := cfn.readFile(file)
 	if err != nil {
-		if cfn.options.ExitOnError {
-			cfn.logger.Fatal(err)
-		}
-		cfn.logger.Error(err)
+		return nil, fmt.Errorf("%w: %w", ErrParameterParse, err)
 	}
 
 	cfn.logger.Debugf("Loading parameters file: %s", file)
@@ -369,35 +446,33 @@ func (cfn *CloudFormationService) parseParametersFile(file string) []types.Param
 	var jsonParams []Parameter
 	err = json.Unmarshal(data, &jsonParams)
 	if err != nil {
-		if cfn.options.ExitOnError {
-			cfn.logger.Fatal(err)
-		}
+		return nil, fmt.Errorf("%w: %s: %w", ErrParameterParse, file, err)
 	}
 
-	params := make([]types.Parameter, len(jsonParams))
-	for i, p := range jsonParams {
-		params[i] = types.Parameter{
-			ParameterKey:   &p.ParameterKey,
-			ParameterValue: &p.ParameterValue}
+	params := make(map[string]string, len(jsonParams))
+	for _, p := range jsonParams {
+		params[p.ParameterKey] = p.ParameterValue
 		cfn.logger.Debugf("%s=%s", p.ParameterKey, p.ParameterValue)
 	}
 
-	return params
+	return params, nil
 }
 
 // Parses a --mappings file to locate the parameters file for a given stack.
 // This allows mapping a standard template name such as vpc.template to a
 // parameters file located in a different directory, file name, or extention,
 // such as vpc-nonprod.parameters, parameters/nonprod/vpc.parameters, or
-// /custom/modules/parameters/vpc.json.
-func (cfn *CloudFormationService) loadParameterMappings(mappingsYaml string) {
+// /custom/modules/parameters/vpc.json. Like parameters files, relative
+// paths are read from the commit being deployed.
+func (cfn *CloudFormationService) loadParameterMappings(mappingsYaml string) error {
 
-	data, err := os.ReadFile(mappingsYaml)
+	if mappingsYaml == "" {
+		return nil
+	}
+
+	data, err := cfn.readFile(mappingsYaml)
 	if err != nil {
-		if cfn.options.ExitOnError {
-			cfn.logger.Fatal(err)
-		}
-		cfn.logger.Error(err)
+		return fmt.Errorf("%w: %w", ErrMappingsParse, err)
 	}
 
 	cfn.logger.Debugf("Loading parameter mappings: %s", mappingsYaml)
@@ -405,24 +480,51 @@ func (cfn *CloudFormationService) loadParameterMappings(mappingsYaml string) {
 	var mappings MappingsYaml
 	err = yaml.Unmarshal(data, &mappings)
 	if err != nil {
-		if cfn.options.ExitOnError {
-			cfn.logger.Fatal(err)
-		}
-		cfn.logger.Error(err)
+		return fmt.Errorf("%w: %s: %w", ErrMappingsParse, mappingsYaml, err)
 	}
 
 	cfn.Mappings = mappings.Templates
+	return nil
 }
 
-// Parses a --dependency-graph dependency graph descriptor
-func (cfn *CloudFormationService) loadDependencies(dependenciesYaml string) {
+// Parses a --stack-names file that maps template files to stack names. This
+// allows a template to be renamed or moved while continuing to update the
+// stack that was created from its previous file name. Relative paths are
+// read from the commit being deployed.
+func (cfn *CloudFormationService) loadStackNames(stackNamesYaml string) error {
 
-	data, err := os.ReadFile(dependenciesYaml)
+	if stackNamesYaml == "" {
+		return nil
+	}
+
+	data, err := cfn.readFile(stackNamesYaml)
 	if err != nil {
-		if cfn.options.ExitOnError {
-			cfn.logger.Fatal(err)
-		}
-		cfn.logger.Error(err)
+		return fmt.Errorf("%w: %w", ErrStackNamesParse, err)
+	}
+
+	cfn.logger.Debugf("Loading stack name mappings: %s", stackNamesYaml)
+
+	stackNames := make(map[string]string)
+	err = yaml.Unmarshal(data, &stackNames)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrStackNamesParse, stackNamesYaml, err)
+	}
+
+	cfn.StackNames = stackNames
+	return nil
+}
+
+// Parses a --dependency-graph dependency graph descriptor. Relative
+// paths are read from the commit being deployed.
+func (cfn *CloudFormationService) loadDependencies(dependenciesYaml string) error {
+
+	if dependenciesYaml == "" {
+		return nil
+	}
+
+	data, err := cfn.readFile(dependenciesYaml)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDependencyParse, err)
 	}
 
 	cfn.logger.Debugf("Loading dependency graph: %s", dependenciesYaml)
@@ -430,10 +532,7 @@ func (cfn *CloudFormationService) loadDependencies(dependenciesYaml string) {
 	var depsYaml []map[string]string
 	err = yaml.Unmarshal(data, &depsYaml)
 	if err != nil {
-		if cfn.options.ExitOnError {
-			cfn.logger.Fatal(err)
-		}
-		cfn.logger.Error(err)
+		return fmt.Errorf("%w: %s: %w", ErrDependencyParse, dependenciesYaml, err)
 	}
 
 	// Copy the unmarshalled map into a new local map
@@ -452,7 +551,9 @@ func (cfn *CloudFormationService) loadDependencies(dependenciesYaml string) {
 	g := NewDependencyGraph()
 	for _, dep := range newDeps {
 		for k, v := range dep {
-			g.DependOn(k, v)
+			if err := g.DependOn(k, v); err != nil {
+				return fmt.Errorf("%w: %s -> %s: %w", ErrDependencyParse, k, v, err)
+			}
 		}
 	}
 
@@ -461,4 +562,6 @@ func (cfn *CloudFormationService) loadDependencies(dependenciesYaml string) {
 	for i, layer := range g.TopoSortedLayers() {
 		cfn.logger.Debugf("execution plan, step %d: %s\n", i+1, strings.Join(layer, ", "))
 	}
+
+	return nil
 }
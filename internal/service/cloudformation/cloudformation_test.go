@@ -0,0 +1,291 @@
+package cloudformation
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/smithy-go"
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	"github.com/jeremyhahn/gitformation/internal/git"
+	"github.com/jeremyhahn/gitformation/internal/plan"
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a service whose CloudFormation client sends requests to a stub
+// server. The handler returns the result XML for each request's action and
+// form parameters.
+func newStubService(t *testing.T, handler func(action string, form url.Values) string) *CloudFormationService {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		action := r.Form.Get("Action")
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<%sResponse xmlns="http://cloudformation.amazonaws.com/doc/2010-05-15/"><%sResult>%s</%sResult></%sResponse>`,
+			action, action, handler(action, r.Form), action, action)
+	}))
+	t.Cleanup(server.Close)
+
+	return &CloudFormationService{
+		logger: logging.MustGetLogger("test"),
+		client: cloudformation.NewFromConfig(aws.Config{
+			Region:       "us-east-1",
+			Credentials:  aws.AnonymousCredentials{},
+			BaseEndpoint: aws.String(server.URL)}),
+		options: &ServiceOptions{}}
+}
+
+func TestExecutionLayers(t *testing.T) {
+	cfn := &CloudFormationService{
+		logger: logging.MustGetLogger("test"),
+		Dependencies: [][]string{
+			{"vpc", "iam"},
+			{"database"},
+			{"web"}}}
+
+	layers := cfn.ExecutionLayers([]string{
+		"templates/web.template",
+		"templates/vpc.template",
+		"templates/unknown.template",
+		"templates/database.yaml"})
+
+	assert.Len(t, layers, 3)
+	assert.ElementsMatch(t, []string{"templates/vpc.template", "templates/unknown.template"}, layers[0])
+	assert.ElementsMatch(t, []string{"templates/database.yaml"}, layers[1])
+	assert.ElementsMatch(t, []string{"templates/web.template"}, layers[2])
+}
+
+func TestExecutionLayersSkipsEmptyLayers(t *testing.T) {
+	cfn := &CloudFormationService{
+		logger: logging.MustGetLogger("test"),
+		Dependencies: [][]string{
+			{"vpc"},
+			{"database"},
+			{"web"}}}
+
+	layers := cfn.ExecutionLayers([]string{"templates/web.template", "templates/vpc.template"})
+
+	assert.Equal(t, [][]string{{"templates/vpc.template"}, {"templates/web.template"}}, layers)
+	assert.Empty(t, cfn.ExecutionLayers([]string{}))
+}
+
+func TestTemplateLocationSendsTemplateBody(t *testing.T) {
+	cfn := &CloudFormationService{
+		logger: logging.MustGetLogger("test"),
+		options: &ServiceOptions{
+			TemplateReader: func(filePath string) ([]byte, error) {
+				return []byte("AWSTemplateFormatVersion: 2010-09-09"), nil
+			}}}
+
+	body, url, err := cfn.templateLocation(&plan.Operation{FilePath: "templates/vpc.template"})
+	assert.NoError(t, err)
+	assert.Nil(t, url)
+	assert.Equal(t, "AWSTemplateFormatVersion: 2010-09-09", *body)
+}
+
+func TestTemplateLocationRequiresBucketForLargeTemplates(t *testing.T) {
+	cfn := &CloudFormationService{
+		logger: logging.MustGetLogger("test"),
+		options: &ServiceOptions{
+			TemplateReader: func(filePath string) ([]byte, error) {
+				return make([]byte, maxTemplateBodySize+1), nil
+			}}}
+
+	_, _, err := cfn.templateLocation(&plan.Operation{FilePath: "templates/vpc.template"})
+	assert.ErrorContains(t, err, "--template-bucket is required")
+}
+
+func TestTemplateLocationUploadsToDeploymentBucket(t *testing.T) {
+
+	template := []byte("AWSTemplateFormatVersion: 2010-09-09")
+
+	// A minimal S3-compatible stand-in that stores objects in memory
+	objects := make(map[string][]byte)
+	headers := make(map[string]http.Header)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			if _, ok := objects[r.URL.Path]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = data
+			headers[r.URL.Path] = r.Header
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	bucket := &DeploymentBucket{
+		BucketName: "deployments",
+		KeyPrefix:  "/gitformation",
+		KMSKeyId:   "alias/deployments",
+		Endpoint:   server.URL}
+
+	cfn := &CloudFormationService{
+		logger: logging.MustGetLogger("test"),
+		s3Client: newS3Client(aws.Config{
+			Region:      "us-east-1",
+			Credentials: aws.AnonymousCredentials{}}, bucket),
+		options: &ServiceOptions{
+			Bucket: bucket,
+			TemplateReader: func(filePath string) ([]byte, error) {
+				return template, nil
+			}}}
+
+	// git hash-object of the template
+	key := "gitformation/fd5f247275092960180314c05c9da9454c7c6c0f/vpc.template"
+	assert.Equal(t, key, cfn.templateKey("templates/vpc.template", template))
+
+	body, url, err := cfn.templateLocation(&plan.Operation{FilePath: "templates/vpc.template"})
+	assert.NoError(t, err)
+	assert.Nil(t, body)
+	assert.Equal(t, server.URL+"/deployments/"+key, *url)
+	assert.Equal(t, template, objects["/deployments/"+key])
+	assert.Equal(t, "aws:kms", headers["/deployments/"+key].Get("X-Amz-Server-Side-Encryption"))
+	assert.Equal(t, "alias/deployments", headers["/deployments/"+key].Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+
+	// Content-addressed templates are only uploaded once
+	delete(headers, "/deployments/"+key)
+	_, _, err = cfn.templateLocation(&plan.Operation{FilePath: "templates/vpc.template"})
+	assert.NoError(t, err)
+	assert.NotContains(t, headers, "/deployments/"+key)
+}
+
+func TestTemplateLocationUploadsWithoutListBucket(t *testing.T) {
+
+	// Without s3:ListBucket, S3 responds 403 to head-object for missing objects
+	var uploaded []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.WriteHeader(http.StatusForbidden)
+		case http.MethodPut:
+			uploaded, _ = io.ReadAll(r.Body)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	bucket := &DeploymentBucket{BucketName: "deployments", Endpoint: server.URL}
+	template := []byte("AWSTemplateFormatVersion: 2010-09-09")
+	cfn := &CloudFormationService{
+		logger: logging.MustGetLogger("test"),
+		s3Client: newS3Client(aws.Config{
+			Region:      "us-east-1",
+			Credentials: aws.AnonymousCredentials{}}, bucket),
+		options: &ServiceOptions{
+			Bucket: bucket,
+			TemplateReader: func(filePath string) ([]byte, error) {
+				return template, nil
+			}}}
+
+	_, url, err := cfn.templateLocation(&plan.Operation{FilePath: "templates/vpc.template"})
+	assert.NoError(t, err)
+	assert.NotNil(t, url)
+	assert.Equal(t, template, uploaded)
+}
+
+func TestStackStatusError(t *testing.T) {
+	assert.NoError(t, stackStatusError(git.Insert, "vpc", "CREATE_COMPLETE"))
+	assert.NoError(t, stackStatusError(git.Update, "vpc", "UPDATE_COMPLETE"))
+	assert.NoError(t, stackStatusError(git.Delete, "vpc", "DELETE_COMPLETE"))
+
+	for actionType, status := range map[git.ActionType]string{
+		git.Insert: "ROLLBACK_COMPLETE",
+		git.Update: "UPDATE_ROLLBACK_COMPLETE",
+		git.Delete: "DELETE_FAILED"} {
+
+		err := stackStatusError(actionType, "vpc", status)
+		var statusErr *executor.StackStatusError
+		assert.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, status, statusErr.Status)
+	}
+}
+
+func TestStackCapabilitiesRejectsInvalidCapability(t *testing.T) {
+	capabilities, err := stackCapabilities(&plan.Operation{
+		Capabilities: []string{"CAPABILITY_IAM", "CAPABILITY_BOGUS"}})
+	assert.Nil(t, capabilities)
+	assert.ErrorIs(t, err, ErrInvalidCapability)
+}
+
+func TestIsNoUpdates(t *testing.T) {
+	assert.True(t, isNoUpdates(&smithy.GenericAPIError{
+		Code:    "ValidationError",
+		Message: "No updates are to be performed."}))
+	assert.False(t, isNoUpdates(&smithy.GenericAPIError{
+		Code:    "ValidationError",
+		Message: "Stack with id vpc does not exist"}))
+	assert.False(t, isNoUpdates(nil))
+
+	assert.True(t, isNoChangesReason("The submitted information didn't contain changes. "+
+		"Submit different information to create a change set."))
+	assert.False(t, isNoChangesReason("Template format error"))
+}
+
+func TestLoadMappingsFromCommit(t *testing.T) {
+	files := map[string]string{
+		"config/mappings.yaml":    "templates/vpc.template: parameters/vpc.json\n",
+		"config/stack-names.yaml": "templates/network.template: vpc\n",
+		"config/graph.yaml":       "- web: vpc\n"}
+	cfn := &CloudFormationService{
+		logger: logging.MustGetLogger("test"),
+		options: &ServiceOptions{
+			TemplateReader: func(filePath string) ([]byte, error) {
+				if data, ok := files[filePath]; ok {
+					return []byte(data), nil
+				}
+				return nil, os.ErrNotExist
+			}}}
+
+	assert.NoError(t, cfn.loadParameterMappings("./config/mappings.yaml"))
+	assert.Equal(t, map[string]string{"templates/vpc.template": "parameters/vpc.json"}, cfn.Mappings)
+	assert.NoError(t, cfn.loadStackNames("./config/stack-names.yaml"))
+	assert.Equal(t, map[string]string{"templates/network.template": "vpc"}, cfn.StackNames)
+	assert.NoError(t, cfn.loadDependencies("./config/graph.yaml"))
+	assert.Equal(t, [][]string{{"vpc"}, {"web"}}, cfn.Dependencies)
+
+	assert.ErrorIs(t, cfn.loadParameterMappings("./config/missing.yaml"), ErrMappingsParse)
+}
+
+func TestTemplateLocationDryRunSkipsUpload(t *testing.T) {
+
+	// Any request to S3 fails the test
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected %s %s during a dry run", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	bucket := &DeploymentBucket{BucketName: "deployments", KeyPrefix: "gitformation", Endpoint: server.URL}
+	template := []byte("AWSTemplateFormatVersion: 2010-09-09")
+	cfn := &CloudFormationService{
+		logger: logging.MustGetLogger("test"),
+		s3Client: newS3Client(aws.Config{
+			Region:      "us-east-1",
+			Credentials: aws.AnonymousCredentials{}}, bucket),
+		options: &ServiceOptions{
+			Bucket: bucket,
+			DryRun: true,
+			TemplateReader: func(filePath string) ([]byte, error) {
+				return template, nil
+			}}}
+
+	body, url, err := cfn.templateLocation(&plan.Operation{FilePath: "templates/vpc.template"})
+	assert.NoError(t, err)
+	assert.Nil(t, body)
+	assert.Equal(t, server.URL+"/deployments/"+cfn.templateKey("templates/vpc.template", template), *url)
+}
@@ -0,0 +1,31 @@
+package cloudformation
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrConfig            = errors.New("unable to load AWS SDK config")
+	ErrParameterParse    = errors.New("unable to parse parameters file")
+	ErrMappingsParse     = errors.New("unable to parse parameter mappings")
+	ErrStackNamesParse   = errors.New("unable to parse stack name mappings")
+	ErrDependencyParse   = errors.New("unable to parse dependency graph")
+	ErrInvalidCapability = errors.New("invalid capability")
+	ErrTemplateList      = errors.New("unable to list templates")
+)
+
+// An error returned by the CloudFormation API while operating on a stack
+type StackOperationError struct {
+	Action    string
+	StackName string
+	Err       error
+}
+
+func (e *StackOperationError) Error() string {
+	return fmt.Sprintf("%s stack %s: %s", e.Action, e.StackName, e.Err)
+}
+
+func (e *StackOperationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,94 @@
+package cloudformation
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// Streams the events for a single stack operation to the console
+type stackEvents struct {
+	cfn       *CloudFormationService
+	stackName string
+	seen      map[string]bool
+	failure   string
+}
+
+func newStackEvents(cfn *CloudFormationService, stackName string) *stackEvents {
+	return &stackEvents{
+		cfn:       cfn,
+		stackName: stackName,
+		seen:      make(map[string]bool)}
+}
+
+// Prints the stack events that have not been seen yet, oldest first, with
+// each line prefixed by the stack name so events from stacks running in
+// parallel can be told apart. Events from before the current operation
+// started are skipped. The reason for the first *_FAILED event is kept as
+// the failure reason for the operation.
+func (events *stackEvents) poll(ctx context.Context, stackId string) {
+
+	unseen := make([]types.StackEvent, 0)
+
+	var nextToken *string
+	for {
+		result, err := events.cfn.client.DescribeStackEvents(ctx, &cloudformation.DescribeStackEventsInput{
+			StackName: &stackId,
+			NextToken: nextToken})
+		if err != nil {
+			events.cfn.logger.Debugf("[%s] unable to describe stack events: %s", events.stackName, err)
+			return
+		}
+
+		// Events are returned newest first
+		done := false
+		for _, event := range result.StackEvents {
+			if events.seen[aws.ToString(event.EventId)] {
+				done = true
+				break
+			}
+			unseen = append(unseen, event)
+			if events.isOperationStart(event) {
+				done = true
+				break
+			}
+		}
+
+		if done || result.NextToken == nil {
+			break
+		}
+		nextToken = result.NextToken
+	}
+
+	for i := len(unseen) - 1; i >= 0; i-- {
+		event := unseen[i]
+		events.seen[aws.ToString(event.EventId)] = true
+
+		status := string(event.ResourceStatus)
+		reason := aws.ToString(event.ResourceStatusReason)
+
+		events.cfn.logger.Infof("[%s] %s %s %s %s %s",
+			events.stackName,
+			aws.ToTime(event.Timestamp).Local().Format("15:04:05"),
+			aws.ToString(event.LogicalResourceId),
+			aws.ToString(event.ResourceType),
+			status,
+			reason)
+
+		if events.failure == "" && strings.HasSuffix(status, "_FAILED") && reason != "" {
+			events.failure = reason
+		}
+	}
+}
+
+// Returns true if the event is the "User Initiated" stack event
+// that marks the start of a create, update or delete.
+func (events *stackEvents) isOperationStart(event types.StackEvent) bool {
+	return aws.ToString(event.ResourceType) == "AWS::CloudFormation::Stack" &&
+		aws.ToString(event.LogicalResourceId) == events.stackName &&
+		strings.HasSuffix(string(event.ResourceStatus), "_IN_PROGRESS") &&
+		aws.ToString(event.ResourceStatusReason) == "User Initiated"
+}
@@ -0,0 +1,145 @@
+package cloudformation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	"github.com/jeremyhahn/gitformation/internal/git"
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// A stack event returned by the stub describe-stack-events
+type stubEvent struct {
+	id, logicalId, resourceType, status, reason string
+}
+
+func (e stubEvent) xml() string {
+	return fmt.Sprintf(`<member><EventId>%s</EventId><StackId>arn:vpc</StackId><StackName>vpc</StackName>`+
+		`<LogicalResourceId>%s</LogicalResourceId><ResourceType>%s</ResourceType>`+
+		`<ResourceStatus>%s</ResourceStatus><ResourceStatusReason>%s</ResourceStatusReason>`+
+		`<Timestamp>2024-01-01T00:00:00Z</Timestamp></member>`,
+		e.id, e.logicalId, e.resourceType, e.status, e.reason)
+}
+
+// Serves stack events newest first, two per page, and counts the pages read
+type stubEvents struct {
+	events []stubEvent // oldest first
+	pages  int
+}
+
+func (s *stubEvents) page(form url.Values) string {
+	s.pages++
+	offset, _ := strconv.Atoi(form.Get("NextToken"))
+	var members strings.Builder
+	end := min(offset+2, len(s.events))
+	for i := offset; i < end; i++ {
+		members.WriteString(s.events[len(s.events)-1-i].xml())
+	}
+	result := "<StackEvents>" + members.String() + "</StackEvents>"
+	if end < len(s.events) {
+		result += fmt.Sprintf("<NextToken>%d</NextToken>", end)
+	}
+	return result
+}
+
+var (
+	previousUpdate = stubEvent{"e1", "vpc", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE", ""}
+	userInitiated  = stubEvent{"e2", "vpc", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", "User Initiated"}
+	subnetUpdate   = stubEvent{"e3", "Subnet", "AWS::EC2::Subnet", "UPDATE_IN_PROGRESS", ""}
+	subnetFailed   = stubEvent{"e4", "Subnet", "AWS::EC2::Subnet", "UPDATE_FAILED", "CIDR conflicts with another subnet"}
+	routeFailed    = stubEvent{"e5", "Route", "AWS::EC2::Route", "UPDATE_FAILED", "Resource update cancelled"}
+	rollback       = stubEvent{"e6", "vpc", "AWS::CloudFormation::Stack", "UPDATE_ROLLBACK_COMPLETE", ""}
+)
+
+// Returns a service whose logger records the stack events it prints
+func newEventsService(t *testing.T, stub *stubEvents, stackStatus string) (*CloudFormationService, *logging.MemoryBackend) {
+	cfn := newStubService(t, func(action string, form url.Values) string {
+		switch action {
+		case "DescribeStackEvents":
+			return stub.page(form)
+		case "DescribeStacks":
+			return `<Stacks><member><StackId>arn:vpc</StackId><StackName>vpc</StackName>` +
+				`<StackStatus>` + stackStatus + `</StackStatus>` +
+				`<CreationTime>2024-01-01T00:00:00Z</CreationTime></member></Stacks>`
+		}
+		t.Errorf("unexpected action %s", action)
+		return ""
+	})
+	backend := logging.NewMemoryBackend(100)
+	cfn.logger = logging.MustGetLogger("events-" + t.Name())
+	cfn.logger.SetBackend(logging.AddModuleLevel(backend))
+	return cfn, backend
+}
+
+// Returns the logical ids of the events printed, in order
+func printedEvents(backend *logging.MemoryBackend) []string {
+	ids := make([]string, 0)
+	for node := backend.Head(); node != nil; node = node.Next() {
+		fields := strings.Fields(node.Record.Message())
+		if len(fields) > 4 && fields[0] == "[vpc]" {
+			ids = append(ids, fields[2]+" "+fields[4])
+		}
+	}
+	return ids
+}
+
+func TestStackEventsPoll(t *testing.T) {
+	stub := &stubEvents{events: []stubEvent{previousUpdate, userInitiated, subnetUpdate, subnetFailed}}
+	cfn, backend := newEventsService(t, stub, "")
+	events := newStackEvents(cfn, "vpc")
+
+	// Pages are read until the event that started the operation,
+	// and events from earlier operations are skipped
+	events.poll(context.Background(), "arn:vpc")
+	assert.Equal(t, 2, stub.pages)
+	assert.Equal(t, []string{
+		"vpc UPDATE_IN_PROGRESS",
+		"Subnet UPDATE_IN_PROGRESS",
+		"Subnet UPDATE_FAILED"}, printedEvents(backend))
+
+	// Only new events are printed, and reading stops at the first seen event
+	stub.events = append(stub.events, routeFailed, rollback)
+	stub.pages = 0
+	events.poll(context.Background(), "arn:vpc")
+	assert.Equal(t, 2, stub.pages)
+	assert.Equal(t, []string{
+		"vpc UPDATE_IN_PROGRESS",
+		"Subnet UPDATE_IN_PROGRESS",
+		"Subnet UPDATE_FAILED",
+		"Route UPDATE_FAILED",
+		"vpc UPDATE_ROLLBACK_COMPLETE"}, printedEvents(backend))
+
+	events.poll(context.Background(), "arn:vpc")
+	assert.Len(t, printedEvents(backend), 5)
+
+	// The first failure is kept
+	assert.Equal(t, "CIDR conflicts with another subnet", events.failure)
+}
+
+func TestWaitForStackFailureReason(t *testing.T) {
+	stub := &stubEvents{events: []stubEvent{
+		previousUpdate, userInitiated, subnetUpdate, subnetFailed, routeFailed, rollback}}
+	cfn, _ := newEventsService(t, stub, "UPDATE_ROLLBACK_COMPLETE")
+	cfn.options.StreamEvents = true
+	cfn.options.StackTimeout = time.Minute
+
+	status, err := cfn.waitForStack(git.Update, "vpc")
+	assert.Equal(t, "UPDATE_ROLLBACK_COMPLETE", status)
+	var statusErr *executor.StackStatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, "CIDR conflicts with another subnet", statusErr.Reason)
+
+	// Without streamed events there is no reason
+	cfn.options.StreamEvents = false
+	_, err = cfn.waitForStack(git.Update, "vpc")
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Empty(t, statusErr.Reason)
+}
@@ -0,0 +1,185 @@
+package cloudformation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jeremyhahn/gitformation/internal/git"
+)
+
+// Reads a file from the commit being deployed, so parameters files are
+// deployed with their templates, even from a remote repository. Relative
+// paths are relative to the repository root and are never read from disk,
+// so a stale local copy of a file missing from the commit is not used.
+// Absolute paths are read from disk.
+func (cfn *CloudFormationService) readFile(filePath string) ([]byte, error) {
+	if cfn.options.TemplateReader == nil || filepath.IsAbs(filePath) {
+		return os.ReadFile(filePath)
+	}
+	return cfn.options.TemplateReader(filepath.ToSlash(filepath.Clean(filePath)))
+}
+
+// Returns the path of the parameters file for a template, using the
+// --parameter-mappings entry for the template file or its stack name,
+// or <--parameter-files>/<env>/<template name>.parameters by default.
+// The file may not exist.
+func (cfn *CloudFormationService) parametersPath(filePath string) string {
+	if file, ok := cfn.Mappings[filePath]; ok {
+		return filepath.Clean(file)
+	}
+	if file, ok := cfn.Mappings[*cfn.parseStackNameFromFile(filePath)]; ok {
+		return filepath.Clean(file)
+	}
+	file := filepath.Base(filePath)
+	fileNameNoExt := strings.Split(file, ".")[0]
+	return filepath.Clean(fmt.Sprintf("%s/%s/%s.parameters", cfn.options.ParameterFiles,
+		cfn.options.Environment, fileNameNoExt))
+}
+
+// Schedules an update of the stack that owns each changed parameters file,
+// so editing a template's parameters redeploys the stack even when the
+// template itself did not change. Parameters files are removed from the
+// changes so they are never deployed as stacks. A deleted parameters file
+// is logged as a warning, since its stack will be updated without it.
+func (cfn *CloudFormationService) ResolveChanges(changeSet *git.ChangeSet) (*git.ChangeSet, error) {
+
+	if cfn.options.TemplateLister == nil {
+		return changeSet, nil
+	}
+
+	listed, err := cfn.options.TemplateLister()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTemplateList, err)
+	}
+
+	// Templates deleted by this change still own their parameters files
+	templates := slices.Concat(listed, changeSet.Deleted)
+	for _, rename := range changeSet.Renamed {
+		templates = append(templates, rename.From)
+	}
+
+	// Map each parameters file to the template that owns it
+	owners := make(map[string]string, len(templates))
+	for _, template := range templates {
+		parametersFile := cfn.parametersPath(template)
+		if parametersFile != template {
+			owners[parametersFile] = template
+		}
+	}
+
+	// Collect the changed parameters files, including
+	// those that did not match the filters
+	changedParameters := make(map[string]bool)
+	deletedParameters := make(map[string]bool)
+	for _, changes := range []*git.ChangeSet{changeSet, changeSet.Filtered} {
+		if changes == nil {
+			continue
+		}
+		changed := slices.Concat(changes.Created, changes.Updated)
+		deleted := slices.Clone(changes.Deleted)
+		for _, rename := range changes.Renamed {
+			changed = append(changed, rename.To)
+			deleted = append(deleted, rename.From)
+		}
+		for _, file := range changed {
+			if _, ok := owners[file]; ok {
+				changedParameters[file] = true
+			}
+		}
+		for _, file := range deleted {
+			if _, ok := owners[file]; ok {
+				deletedParameters[file] = true
+			}
+		}
+	}
+	isParameters := func(file string) bool {
+		return changedParameters[file] || deletedParameters[file]
+	}
+
+	resolved := git.NewChangeSet(
+		slices.DeleteFunc(slices.Clone(changeSet.Created), isParameters),
+		slices.DeleteFunc(slices.Clone(changeSet.Updated), isParameters),
+		slices.DeleteFunc(slices.Clone(changeSet.Deleted), isParameters),
+		slices.DeleteFunc(slices.Clone(changeSet.Renamed), func(rename *git.Rename) bool {
+			return isParameters(rename.From) || isParameters(rename.To)
+		}))
+	resolved.Triggered = make(map[string]string)
+	resolved.Directives = changeSet.Directives
+	resolved.Filtered = changeSet.Filtered
+
+	// Templates that already have an operation scheduled
+	scheduled := make(map[string]bool)
+	for _, file := range slices.Concat(resolved.Created, resolved.Updated, resolved.Deleted) {
+		scheduled[file] = true
+	}
+	for _, rename := range resolved.Renamed {
+		scheduled[rename.From] = true
+		scheduled[rename.To] = true
+	}
+
+	parametersFiles := make([]string, 0, len(changedParameters)+len(deletedParameters))
+	for file := range changedParameters {
+		parametersFiles = append(parametersFiles, file)
+	}
+	for file := range deletedParameters {
+		if !changedParameters[file] {
+			parametersFiles = append(parametersFiles, file)
+		}
+	}
+	slices.Sort(parametersFiles)
+
+	for _, parametersFile := range parametersFiles {
+		template := owners[parametersFile]
+		if scheduled[template] {
+			continue
+		}
+		if deletedParameters[parametersFile] && !changedParameters[parametersFile] {
+			cfn.logger.Warningf("parameters file %s was deleted, stack %s will be updated without it",
+				parametersFile, *cfn.parseStackNameFromFile(template))
+		} else {
+			cfn.logger.Infof("parameters file %s changed, updating %s", parametersFile, template)
+		}
+		resolved.Updated = append(resolved.Updated, template)
+		resolved.Triggered[template] = parametersFile
+		scheduled[template] = true
+	}
+
+	if directives := changeSet.Directives; directives != nil && directives.DeploysTo(cfn.options.Environment) {
+		cfn.forceRedeploy(resolved, changeSet.Directives.ForceRedeploy, listed, owners, scheduled)
+	}
+
+	return resolved, nil
+}
+
+// Schedules an update of each stack listed in a Force-Redeploy commit
+// trailer that does not already have an operation scheduled.
+func (cfn *CloudFormationService) forceRedeploy(
+	resolved *git.ChangeSet,
+	stackNames []string,
+	templates []string,
+	owners map[string]string,
+	scheduled map[string]bool) {
+
+	for _, stackName := range stackNames {
+		found := false
+		for _, template := range templates {
+			if _, ok := owners[template]; ok || *cfn.parseStackNameFromFile(template) != stackName {
+				continue
+			}
+			found = true
+			if scheduled[template] {
+				continue
+			}
+			cfn.logger.Infof("%s %s, updating %s", git.ForceRedeployTrailer, stackName, template)
+			resolved.Updated = append(resolved.Updated, template)
+			resolved.Triggered[template] = git.ForceRedeployTrailer
+			scheduled[template] = true
+		}
+		if !found {
+			cfn.logger.Warningf("%s: no template found for stack %s", git.ForceRedeployTrailer, stackName)
+		}
+	}
+}
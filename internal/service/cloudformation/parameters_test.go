@@ -0,0 +1,137 @@
+package cloudformation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeremyhahn/gitformation/internal/git"
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func newParametersService(mappings map[string]string, templates ...string) *CloudFormationService {
+	return &CloudFormationService{
+		logger:   logging.MustGetLogger("test"),
+		Mappings: mappings,
+		options: &ServiceOptions{
+			ParameterFiles: "./parameters",
+			Environment:    "nonprod",
+			TemplateLister: func() ([]string, error) {
+				return templates, nil
+			}}}
+}
+
+func TestParametersPath(t *testing.T) {
+	cfn := newParametersService(map[string]string{
+		"templates/db.template": "./custom/db.json",
+		"web":                   "custom/web.json"})
+
+	assert.Equal(t, "parameters/nonprod/vpc.parameters", cfn.parametersPath("templates/vpc.template"))
+	assert.Equal(t, "custom/db.json", cfn.parametersPath("templates/db.template"))
+	assert.Equal(t, "custom/web.json", cfn.parametersPath("templates/web.template"))
+}
+
+func TestResolveChangesUpdatesOwningStack(t *testing.T) {
+	cfn := newParametersService(map[string]string{"web": "custom/web.json"},
+		"templates/vpc.template", "templates/web.template", "templates/db.template")
+
+	changeSet := git.NewChangeSet(
+		[]string{},
+		[]string{"parameters/nonprod/vpc.parameters", "templates/db.template"},
+		[]string{},
+		[]*git.Rename{})
+	changeSet.Filtered = git.NewChangeSet(
+		[]string{"custom/web.json"},
+		[]string{"parameters/nonprod/db.parameters", "README.md"},
+		[]string{},
+		[]*git.Rename{})
+
+	resolved, err := cfn.ResolveChanges(changeSet)
+	assert.NoError(t, err)
+	assert.Empty(t, resolved.Created)
+	assert.Equal(t, []string{"templates/db.template", "templates/web.template", "templates/vpc.template"}, resolved.Updated)
+	assert.Equal(t, map[string]string{
+		"templates/vpc.template": "parameters/nonprod/vpc.parameters",
+		"templates/web.template": "custom/web.json"}, resolved.Triggered)
+
+	// The original changes are not modified
+	assert.Equal(t, []string{"parameters/nonprod/vpc.parameters", "templates/db.template"}, changeSet.Updated)
+}
+
+func TestResolveChangesDeletedParametersFile(t *testing.T) {
+	cfn := newParametersService(nil, "templates/vpc.template")
+
+	changeSet := git.NewChangeSet(
+		[]string{},
+		[]string{},
+		[]string{"parameters/nonprod/vpc.parameters", "parameters/nonprod/web.parameters", "templates/web.template"},
+		[]*git.Rename{})
+
+	resolved, err := cfn.ResolveChanges(changeSet)
+	assert.NoError(t, err)
+
+	// The deleted template's parameters file is deleted with it
+	assert.Equal(t, []string{"templates/web.template"}, resolved.Deleted)
+	assert.Equal(t, []string{"templates/vpc.template"}, resolved.Updated)
+	assert.Equal(t, "parameters/nonprod/vpc.parameters", resolved.Triggered["templates/vpc.template"])
+}
+
+func TestResolveChangesWithoutLister(t *testing.T) {
+	cfn := newParametersService(nil)
+	cfn.options.TemplateLister = nil
+
+	changeSet := git.NewChangeSet([]string{}, []string{"parameters/nonprod/vpc.parameters"}, []string{}, []*git.Rename{})
+	resolved, err := cfn.ResolveChanges(changeSet)
+	assert.NoError(t, err)
+	assert.Same(t, changeSet, resolved)
+}
+
+func TestResolveChangesForceRedeploy(t *testing.T) {
+	cfn := newParametersService(nil,
+		"templates/vpc.template", "templates/web.template", "parameters/nonprod/web.parameters")
+
+	changeSet := git.NewChangeSet([]string{}, []string{"templates/vpc.template"}, []string{}, []*git.Rename{})
+	changeSet.Directives = &git.Directives{ForceRedeploy: []string{"vpc", "web", "missing"}}
+
+	resolved, err := cfn.ResolveChanges(changeSet)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"templates/vpc.template", "templates/web.template"}, resolved.Updated)
+	assert.Equal(t, map[string]string{"templates/web.template": git.ForceRedeployTrailer}, resolved.Triggered)
+	assert.Same(t, changeSet.Directives, resolved.Directives)
+}
+
+func TestReadFileFromCommit(t *testing.T) {
+	onDisk := filepath.Join(t.TempDir(), "vpc.parameters")
+	assert.NoError(t, os.WriteFile(onDisk, []byte("disk"), 0644))
+
+	cfn := newParametersService(nil)
+	cfn.options.TemplateReader = func(filePath string) ([]byte, error) {
+		if filePath == "parameters/nonprod/vpc.parameters" {
+			return []byte("commit"), nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	data, err := cfn.readFile("parameters/nonprod/vpc.parameters")
+	assert.NoError(t, err)
+	assert.Equal(t, "commit", string(data))
+
+	data, err = cfn.readFile(onDisk)
+	assert.NoError(t, err)
+	assert.Equal(t, "disk", string(data))
+
+	// Files missing from the commit are never read from the current directory
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "parameters", "nonprod"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "parameters", "nonprod", "stale.parameters"), []byte("stale"), 0644))
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(cwd)
+
+	_, err = cfn.readFile("parameters/nonprod/stale.parameters")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = cfn.readFile("./parameters/nonprod/missing.parameters")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
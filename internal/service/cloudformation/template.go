@@ -0,0 +1,149 @@
+package cloudformation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/jeremyhahn/gitformation/internal/plan"
+)
+
+// The maximum size of a template passed inline using TemplateBody.
+// Larger templates must be uploaded to S3 and passed using TemplateURL.
+const maxTemplateBodySize = 51200
+
+// Returns the template body or template url for an operation. The template
+// is read from the commit being deployed, not the working tree. When a
+// deployment bucket is defined, the template is uploaded to the bucket and
+// passed using a template url, otherwise it is passed inline.
+func (cfn *CloudFormationService) templateLocation(op *plan.Operation) (body *string, url *string, err error) {
+
+	if cfn.options.TemplateReader == nil {
+		return nil, nil, fmt.Errorf("unable to read template %s: no template reader configured", op.FilePath)
+	}
+
+	data, err := cfn.options.TemplateReader(op.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfn.options.Bucket != nil {
+		templateUrl, err := cfn.uploadTemplate(op.FilePath, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, &templateUrl, nil
+	}
+
+	if len(data) > maxTemplateBodySize {
+		return nil, nil, fmt.Errorf("template %s is %d bytes, which exceeds the %d byte TemplateBody limit: --template-bucket is required",
+			op.FilePath, len(data), maxTemplateBodySize)
+	}
+
+	templateBody := string(data)
+	return &templateBody, nil, nil
+}
+
+// Uploads a template to the deployment bucket and returns its url. Templates
+// are content-addressed by their git blob hash, so a template that has
+// already been uploaded is not uploaded again. Dry runs never call S3 and
+// return the url the template would be uploaded to.
+func (cfn *CloudFormationService) uploadTemplate(filePath string, data []byte) (string, error) {
+
+	bucket := cfn.options.Bucket
+	key := cfn.templateKey(filePath, data)
+
+	if cfn.options.DryRun {
+		cfn.logger.Infof("dry run: template %s would be uploaded to s3://%s/%s", filePath, bucket.BucketName, key)
+		return cfn.templateURL(key), nil
+	}
+
+	_, err := cfn.s3Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: &bucket.BucketName,
+		Key:    &key})
+	if err == nil {
+		cfn.logger.Debugf("template %s already uploaded to s3://%s/%s", filePath, bucket.BucketName, key)
+		return cfn.templateURL(key), nil
+	}
+	if !isObjectNotFound(err) {
+		return "", fmt.Errorf("unable to check for template %s in s3://%s/%s: %w",
+			filePath, bucket.BucketName, key, err)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: &bucket.BucketName,
+		Key:    &key,
+		Body:   bytes.NewReader(data)}
+	if bucket.KMSKeyId != "" {
+		input.ServerSideEncryption = s3types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = &bucket.KMSKeyId
+	}
+
+	cfn.logger.Infof("uploading template %s to s3://%s/%s", filePath, bucket.BucketName, key)
+
+	if _, err := cfn.s3Client.PutObject(context.TODO(), input); err != nil {
+		return "", fmt.Errorf("unable to upload template %s to s3://%s/%s: %w",
+			filePath, bucket.BucketName, key, err)
+	}
+
+	return cfn.templateURL(key), nil
+}
+
+// Returns true if head-object could not find an object. Without
+// s3:ListBucket, S3 responds 403 instead of 404 for missing objects, so
+// both mean the template still has to be uploaded.
+func isObjectNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound" {
+		return true
+	}
+	var respErr *smithyhttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusForbidden
+}
+
+// Returns the content-addressed object key for a template:
+// <key-prefix>/<git-blob-hash>/<file-name>
+func (cfn *CloudFormationService) templateKey(filePath string, data []byte) string {
+	key := path.Join(cfn.options.Bucket.KeyPrefix, blobHash(data), path.Base(filePath))
+	return strings.TrimPrefix(key, "/")
+}
+
+// Returns the url of a template object in the deployment bucket
+func (cfn *CloudFormationService) templateURL(key string) string {
+	bucket := cfn.options.Bucket
+	if bucket.Endpoint != "" {
+		return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(bucket.Endpoint, "/"), bucket.BucketName, key)
+	}
+	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", bucket.BucketName, key)
+}
+
+// Creates an S3 client for the deployment bucket. A custom endpoint, such
+// as a local S3-compatible server, is addressed using path-style urls.
+func newS3Client(cfg aws.Config, bucket *DeploymentBucket) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if bucket != nil && bucket.Endpoint != "" {
+			o.BaseEndpoint = &bucket.Endpoint
+			o.UsePathStyle = true
+		}
+	})
+}
+
+// Returns the git blob hash of the data (the same as git hash-object)
+func blobHash(data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
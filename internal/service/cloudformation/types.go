@@ -1,5 +1,11 @@
 package cloudformation
 
+import (
+	"time"
+
+	"github.com/jeremyhahn/gitformation/internal/executor"
+)
+
 type Parameter struct {
 	ParameterKey   string `json:"ParameterKey"`
 	ParameterValue string `json:"ParameterValue"`
@@ -8,6 +14,8 @@ type Parameter struct {
 type DeploymentBucket struct {
 	BucketName string
 	KeyPrefix  string
+	KMSKeyId   string
+	Endpoint   string
 }
 
 type ServiceOptions struct {
@@ -23,10 +31,24 @@ type ServiceOptions struct {
 	ExitOnError           bool
 	WaitForStackResult    bool
 	ParameterFileMappings string
+	StackNameMappings     string
 	DependencyGraph       string
 	DryRun                bool
+	UseChangeSets         bool
+	ChangeSetCreates      bool
+	ReviewChangeSet       executor.ChangeSetReviewFunc
+	TemplateReader        TemplateReader
+	TemplateLister        TemplateLister
+	StackTimeout          time.Duration
+	StreamEvents          bool
 }
 
+// Returns the contents of a template or parameters file from the commit being deployed
+type TemplateReader func(filePath string) ([]byte, error)
+
+// Returns the files in the commit being deployed that match the filters
+type TemplateLister func() ([]string, error)
+
 type MappingsYaml struct {
 	Templates map[string]string
 }
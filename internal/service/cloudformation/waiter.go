@@ -0,0 +1,179 @@
+package cloudformation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/smithy-go"
+
+	"github.com/jeremyhahn/gitformation/internal/executor"
+	"github.com/jeremyhahn/gitformation/internal/git"
+)
+
+// The initial and maximum delay between describe-stacks polls
+var (
+	waitMinDelay = 5 * time.Second
+	waitMaxDelay = 30 * time.Second
+)
+
+// Sends the result of a stack operation to the executor. If the executor
+// requested a wait, or --wait is set, the operation is first waited on until
+// the stack reaches a terminal state and the final stack status is reported.
+// Otherwise the operation is reported as in progress.
+func (cfn *CloudFormationService) sendResponse(
+	serviceParams *executor.ServiceParams,
+	actionType git.ActionType,
+	stackId string) {
+
+	op := serviceParams.Operation
+	status := inProgressStatus(actionType)
+
+	if serviceParams.Wait || cfn.options.WaitForStackResult {
+		var err error
+		status, err = cfn.waitForStack(actionType, op.StackName)
+		if err != nil {
+			response := make(map[string]error, 1)
+			response[op.FilePath] = err
+			serviceParams.ErrorChan <- response
+			return
+		}
+	}
+
+	serviceParams.ResponseChan <- &executor.OperationResponse{
+		FilePath:  op.FilePath,
+		StackName: op.StackName,
+		StackId:   stackId,
+		Status:    status}
+}
+
+// Waits for a stack operation to reach a terminal state by polling
+// describe-stacks with exponential backoff. Returns the final stack
+// status, and an error if the operation failed, rolled back, or did
+// not finish within the --stack-timeout.
+func (cfn *CloudFormationService) waitForStack(actionType git.ActionType, stackName string) (string, error) {
+
+	ctx := context.Background()
+	if cfn.options.StackTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfn.options.StackTimeout)
+		defer cancel()
+	}
+
+	status := inProgressStatus(actionType)
+	delay := waitMinDelay
+
+	var stackId string
+	var events *stackEvents
+	if cfn.options.StreamEvents {
+		events = newStackEvents(cfn, stackName)
+	}
+
+	for {
+		result, err := cfn.client.DescribeStacks(ctx,
+			&cloudformation.DescribeStacksInput{StackName: &stackName})
+		if err != nil {
+			if actionType == git.Delete && isStackNotFound(err) {
+				if events != nil && stackId != "" {
+					events.poll(ctx, stackId)
+				}
+				return "DELETE_COMPLETE", nil
+			}
+			if ctx.Err() != nil {
+				return status, cfn.timeoutError(stackName, status)
+			}
+			return status, err
+		}
+		if len(result.Stacks) == 0 {
+			return status, fmt.Errorf("unexpected response from describe-stacks: stacks.length = 0")
+		}
+
+		stack := result.Stacks[0]
+		stackId = aws.ToString(stack.StackId)
+		status = string(stack.StackStatus)
+		cfn.logger.Debugf("%s: %s", stackName, status)
+
+		// Stack events are described by stack id so
+		// they can still be read once a stack is deleted.
+		if events != nil {
+			events.poll(ctx, stackId)
+		}
+
+		if !strings.HasSuffix(status, "_IN_PROGRESS") {
+			err := stackStatusError(actionType, stackName, status)
+			var statusErr *executor.StackStatusError
+			if events != nil && errors.As(err, &statusErr) {
+				statusErr.Reason = events.failure
+			}
+			return status, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, cfn.timeoutError(stackName, status)
+		case <-time.After(delay):
+		}
+		delay = min(delay*3/2, waitMaxDelay)
+	}
+}
+
+// Returns an error if a terminal stack status is not the
+// successful completion of the requested action.
+func stackStatusError(actionType git.ActionType, stackName, status string) error {
+	var expected string
+	switch actionType {
+	case git.Insert:
+		expected = "CREATE_COMPLETE"
+	case git.Update:
+		expected = "UPDATE_COMPLETE"
+	case git.Delete:
+		expected = "DELETE_COMPLETE"
+	}
+	if status == expected {
+		return nil
+	}
+	return &executor.StackStatusError{
+		StackName: stackName,
+		Status:    status}
+}
+
+// The status reported for operations skipped by --dry-run
+const dryRunStatus = "DRY_RUN"
+
+// Returns the status reported for an operation that is not waited on
+func inProgressStatus(actionType git.ActionType) string {
+	switch actionType {
+	case git.Insert:
+		return "CREATE_IN_PROGRESS"
+	case git.Update:
+		return "UPDATE_IN_PROGRESS"
+	}
+	return "DELETE_IN_PROGRESS"
+}
+
+func (cfn *CloudFormationService) timeoutError(stackName, status string) error {
+	return fmt.Errorf("timed out after %s waiting for stack %s (last status: %s)",
+		cfn.options.StackTimeout, stackName, status)
+}
+
+// Returns true if update-stack failed because the template and parameters
+// match the deployed stack, such as when only comments or whitespace in
+// the template have changed.
+func isNoUpdates(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) &&
+		apiErr.ErrorCode() == "ValidationError" &&
+		strings.Contains(apiErr.ErrorMessage(), "No updates are to be performed")
+}
+
+// Returns true if describe-stacks failed because the stack does not exist
+func isStackNotFound(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) &&
+		apiErr.ErrorCode() == "ValidationError" &&
+		strings.Contains(apiErr.ErrorMessage(), "does not exist")
+}